@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestDeadlineCause(t *testing.T) {
+	ctx, cancel := context.WithTimeoutCause(context.Background(), time.Millisecond, errDeadline)
+	defer cancel()
+	<-ctx.Done()
+
+	res := checker.CheckURL(ctx, "tcp://127.0.0.1:1")
+	if !errors.Is(res.Error, checker.ErrCanceled) || !strings.Contains(res.Error.Error(), "-deadline") {
+		t.Errorf("期望因为超过 -deadline 而取消, 但得到了 %v", res.Error)
+	}
+	if res.Attempts != 0 {
+		t.Errorf("期望没有发起检查, 但尝试了 %d 次", res.Attempts)
+	}
+}
+
+func TestCanceledSummary(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errors.New("收到信号 interrupt"))
+
+	const n = 3
+	targets := make([]checker.Target, n)
+	for i := range targets {
+		targets[i] = checker.Target{URL: "tcp://127.0.0.1:1"}
+	}
+	var all []checker.Result
+	for res := range checker.Run(ctx, targets, checker.Options{}) {
+		all = append(all, res)
+	}
+	if s := summarize(all); s.Canceled != n || s.Fail != n {
+		t.Errorf("期望统计到 %d 个已取消, 但得到了 %+v", n, s)
+	}
+
+	var buf strings.Builder
+	if err := (&textWriter{out: &buf}).Close(summarize(all)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "已取消: 3（报告不完整）") {
+		t.Errorf("期望报告注明结果不完整, 但得到了:\n%s", buf.String())
+	}
+}
+
+// 被取消之后没有读到的目标也要出现在报告中，而不是直接消失
+func TestFeedTargetsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	const n = 100
+	stream := targetStream(func(yield func(checker.Target) bool) error {
+		for range n {
+			if !yield(checker.Target{URL: "tcp://127.0.0.1:1"}) {
+				return nil
+			}
+		}
+		return nil
+	})
+	jobs := make(chan checker.Target, 1)
+	read := 0
+	go feedTargets(stream, jobs, func(*checker.Target) {
+		if read++; read == 10 {
+			cancel(errors.New("收到信号 interrupt"))
+		}
+	})
+	var s SummaryRecorder
+	for res := range checker.RunStream(ctx, jobs, checker.Options{Concurrency: 2}) {
+		s.Add(res)
+	}
+	if got := s.Summary(); got.Total != n || got.Canceled < n-10 {
+		t.Errorf("期望 %d 个结果, 其中至少 %d 个已取消, 但得到了 %+v", n, n-10, got)
+	}
+}
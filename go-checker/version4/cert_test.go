@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestCertWarnState(t *testing.T) {
+	res := checker.Result{Kind: "tls", Warnings: []string{"证书将在 3 天后过期"}}
+	if got := stateOf(res); got != StateWarn {
+		t.Errorf("期望状态为 WARN, 但得到了 %s", got)
+	}
+	if got := exitCode(summarize([]checker.Result{res})); got != exitWarn {
+		t.Errorf("期望退出码 %d, 但得到了 %d", exitWarn, got)
+	}
+}
+
+func TestCertConfig(t *testing.T) {
+	targets, err := parseConfig("checks.json", []byte(`{"defaults": {"cert_warn": "30d"}, "targets": [
+  {"url": "tls://a.com:443", "insecure": true},
+  {"url": "https://b.com", "cert_warn": "0"}
+]}`))
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	if targets[0].CertWarn != 30*24*time.Hour || !targets[0].Insecure {
+		t.Errorf("期望 tls 目标继承默认的警告阈值, 但得到了 %+v", targets[0])
+	}
+	if targets[1].CertWarn >= 0 {
+		t.Errorf("期望 \"0\" 表示不检查有效期, 但得到了 %v", targets[1].CertWarn)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		s    Summary
+		want int
+	}{
+		{Summary{Total: 2, Success: 2}, exitOK},
+		{Summary{Total: 2, Success: 2, Warn: 1}, exitWarn},
+		{Summary{Total: 2, Success: 1, Fail: 1, Warn: 1}, exitFail},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.s); got != tt.want {
+			t.Errorf("%+v: 期望退出码 %d, 但得到了 %d", tt.s, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package checker
+
+import (
+	"sync"
+	"time"
+)
+
+// AdaptivePolicy 让 worker 池的大小随检查的情况变化，思路和 TCP 拥塞控制一样是 AIMD（加性增、乘性减）：
+// 每隔 Interval 看一次这段时间完成的检查，出错（超时、连接被拒绝等网络错误）的比例超过 MaxErrorRate，
+// 或者平均延迟超过基准的 LatencyFactor 倍，说明目标或者本机已经忙不过来了，并发数乘以 Decrease；
+// 否则只要 worker 都在忙（说明还有目标在排队），并发数就加上 Increase。
+// 零值的字段使用下面 withDefaults 中的默认值。
+type AdaptivePolicy struct {
+	Min           int           // 并发数的下限，默认 1
+	Max           int           // 并发数的上限，默认 100
+	Interval      time.Duration // 调整的间隔，默认 250ms
+	Increase      int           // 每次增加多少，默认 2
+	Decrease      float64       // 每次减少时乘以多少，0~1，默认 0.75
+	MaxErrorRate  float64       // 出错比例超过它时减少，默认 0.1
+	LatencyFactor float64       // 平均延迟超过基准的多少倍时减少，默认 2
+	// OnResize 在并发数变化时调用（开始时也调用一次），在调整的 goroutine 中执行
+	OnResize func(r Resize)
+}
+
+// Resize 是并发数的一次变化，用来画出整个运行过程中的并发数曲线
+type Resize struct {
+	At        time.Duration // 距离开始运行的时间
+	From, To  int
+	Reason    string        // 见下面的 Resize 常量
+	Completed int           // 这段时间完成的检查数
+	ErrorRate float64       // 这段时间网络错误的比例
+	Latency   time.Duration // 这段时间成功检查的平均延迟
+}
+
+// 并发数变化的原因
+const (
+	ResizeStart   = "start"   // 开始运行，From 为 0
+	ResizeBusy    = "busy"    // worker 都在忙，增加
+	ResizeErrors  = "errors"  // 错误比例太高，减少
+	ResizeLatency = "latency" // 延迟明显变高，减少
+)
+
+func (p AdaptivePolicy) withDefaults() AdaptivePolicy {
+	if p.Min <= 0 {
+		p.Min = 1
+	}
+	if p.Max <= 0 {
+		p.Max = 100
+	}
+	p.Max = max(p.Max, p.Min)
+	if p.Interval <= 0 {
+		p.Interval = 250 * time.Millisecond
+	}
+	if p.Increase <= 0 {
+		p.Increase = 2
+	}
+	if p.Decrease <= 0 || p.Decrease >= 1 {
+		p.Decrease = 0.75
+	}
+	if p.MaxErrorRate <= 0 {
+		p.MaxErrorRate = 0.1
+	}
+	if p.LatencyFactor <= 1 {
+		p.LatencyFactor = 2
+	}
+	return p
+}
+
+// limiter 是一个上限可以调整的信号量，worker 检查之前先拿到一个名额。
+// 同时它也统计每个调整周期内的检查情况，供 control 决定怎么调整。
+type limiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int // 拿到名额的 worker 数，包括正在等待目标的
+	busy   int // 正在检查的 worker 数
+	window adaptiveWindow
+}
+
+// adaptiveWindow 是一个调整周期内的统计
+type adaptiveWindow struct {
+	peak      int // busy 的最大值
+	completed int
+	errors    int
+	ok        int
+	latency   time.Duration // 成功检查的延迟之和
+}
+
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire 等到有空闲的名额
+func (l *limiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// start 标记拿到名额的 worker 开始检查一个目标
+func (l *limiter) start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.busy++
+	l.window.peak = max(l.window.peak, l.busy)
+}
+
+// release 归还名额，res 为 nil 表示没有检查目标（targets 已经关闭）
+func (l *limiter) release(res *Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if res != nil {
+		l.busy--
+		l.observe(*res)
+	}
+	l.cond.Signal()
+}
+
+// observe 统计一个结果。被取消和被熔断跳过的检查不代表目标的情况，不统计
+func (l *limiter) observe(res Result) {
+	switch res.Category() {
+	case CategoryCanceled, CategorySkipped:
+		return
+	case CategoryTimeout, CategoryRefused, CategoryNetwork:
+		l.window.errors++
+	}
+	l.window.completed++
+	if res.OK() {
+		l.window.ok++
+		l.window.latency += res.Latency
+	}
+}
+
+// next 取出这个周期的统计并开始新的周期
+func (l *limiter) next() (adaptiveWindow, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.window
+	l.window = adaptiveWindow{peak: l.busy}
+	return w, l.limit
+}
+
+// resize 调整上限，变大时唤醒所有等待的 worker；变小时多出来的 worker 检查完手上的目标后就会停下等待
+func (l *limiter) resize(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = n
+	l.cond.Broadcast()
+}
+
+// control 每隔 p.Interval 根据统计调整 l 的上限，直到 done 被关闭
+func (l *limiter) control(p AdaptivePolicy, done <-chan struct{}) {
+	start := time.Now()
+	if p.OnResize != nil {
+		p.OnResize(Resize{To: l.limit, Reason: ResizeStart})
+	}
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	var baseline time.Duration
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		w, limit := l.next()
+		r, ok := p.decide(w, limit, &baseline)
+		if !ok {
+			continue
+		}
+		r.At = time.Since(start)
+		l.resize(r.To)
+		if p.OnResize != nil {
+			p.OnResize(r)
+		}
+	}
+}
+
+// decide 根据一个周期的统计决定新的并发数，不需要调整时返回 false。
+// baseline 是目前见过的最低的平均延迟，每个周期放宽 5%，这样目标换了一批（比如从快的站点换成慢的）之后
+// 不会因为和早先的低延迟比较而一直减少
+func (p AdaptivePolicy) decide(w adaptiveWindow, limit int, baseline *time.Duration) (Resize, bool) {
+	if w.completed == 0 {
+		return Resize{}, false // 这段时间没有检查完成，没有依据
+	}
+	r := Resize{From: limit, Completed: w.completed, ErrorRate: float64(w.errors) / float64(w.completed)}
+	if w.ok > 0 {
+		r.Latency = w.latency / time.Duration(w.ok)
+		if *baseline == 0 || r.Latency < *baseline {
+			*baseline = r.Latency
+		} else {
+			*baseline += *baseline / 20
+		}
+	}
+	switch {
+	case r.ErrorRate > p.MaxErrorRate:
+		r.To, r.Reason = max(int(float64(limit)*p.Decrease), p.Min), ResizeErrors
+	case r.Latency > time.Duration(float64(*baseline)*p.LatencyFactor):
+		r.To, r.Reason = max(int(float64(limit)*p.Decrease), p.Min), ResizeLatency
+	case w.peak >= limit:
+		r.To, r.Reason = min(limit+p.Increase, p.Max), ResizeBusy
+	}
+	return r, r.To != 0 && r.To != limit
+}
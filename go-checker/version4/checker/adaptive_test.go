@@ -0,0 +1,88 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveDecide(t *testing.T) {
+	p := AdaptivePolicy{Min: 2, Max: 10}.withDefaults()
+	var baseline time.Duration
+	tests := []struct {
+		name   string
+		w      adaptiveWindow
+		limit  int
+		to     int
+		reason string
+	}{
+		{"满载时增加", adaptiveWindow{peak: 4, completed: 10, ok: 10, latency: 100 * time.Millisecond}, 4, 6, ResizeBusy},
+		{"没有满载不调整", adaptiveWindow{peak: 3, completed: 10, ok: 10, latency: 100 * time.Millisecond}, 6, 6, ""},
+		{"不超过上限", adaptiveWindow{peak: 10, completed: 10, ok: 10, latency: 100 * time.Millisecond}, 10, 10, ""},
+		{"延迟翻倍时减少", adaptiveWindow{peak: 8, completed: 10, ok: 10, latency: 300 * time.Millisecond}, 8, 6, ResizeLatency},
+		{"错误太多时减少", adaptiveWindow{peak: 8, completed: 10, errors: 5, ok: 5, latency: 50 * time.Millisecond}, 8, 6, ResizeErrors},
+		{"不低于下限", adaptiveWindow{peak: 2, completed: 10, errors: 10}, 2, 2, ""},
+		{"没有完成的检查不调整", adaptiveWindow{peak: 2}, 2, 2, ""},
+	}
+	for _, tc := range tests {
+		r, ok := p.decide(tc.w, tc.limit, &baseline)
+		if !ok {
+			r.To, r.Reason = tc.limit, ""
+		}
+		if r.To != tc.to || r.Reason != tc.reason {
+			t.Errorf("%s: 期望调整到 %d（%s）, 但得到了 %d（%s）", tc.name, tc.to, tc.reason, r.To, r.Reason)
+		}
+	}
+}
+
+func TestAdaptiveRun(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	var (
+		mu      sync.Mutex
+		resizes []Resize
+	)
+	opts := Options{Concurrency: 1, Adaptive: &AdaptivePolicy{
+		Min: 1, Max: 6, Interval: 10 * time.Millisecond, Increase: 1,
+		OnResize: func(r Resize) {
+			mu.Lock()
+			defer mu.Unlock()
+			resizes = append(resizes, r)
+		},
+	}}
+	targets := make([]Target, 150)
+	for i := range targets {
+		targets[i] = Target{URL: server.URL}
+	}
+	n := 0
+	for res := range Run(context.Background(), targets, opts) {
+		if !res.OK() {
+			t.Fatalf("期望检查成功, 但得到了 %v", res.Error)
+		}
+		n++
+	}
+	if n != len(targets) {
+		t.Fatalf("期望 %d 个结果, 但得到了 %d 个", len(targets), n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(resizes) < 2 || resizes[0].Reason != ResizeStart || resizes[0].To != 1 {
+		t.Fatalf("期望先记录初始并发数再逐渐增加, 但得到了 %+v", resizes)
+	}
+	if p := peak.Load(); p < 2 || p > 6 {
+		t.Errorf("期望同时进行的请求在 2 到 6 之间, 但最多有 %d 个", p)
+	}
+}
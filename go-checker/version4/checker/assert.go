@@ -0,0 +1,187 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxAssertBody 是为了做断言最多读取的响应体大小，防止超大响应耗尽内存
+const MaxAssertBody = 1 << 20
+
+// Assertions 描述对一个目标的 HTTP 响应的期望。
+// 字段都为空时，只要求状态码在 200-399 之间。
+type Assertions struct {
+	Status    []StatusRange     // 期望的状态码集合或范围，为空时默认 200-399
+	Body      string            // 响应体必须包含的子串
+	BodyRegex *regexp.Regexp    // 响应体必须匹配的正则
+	Headers   map[string]string // 必须出现的响应头及其值
+	JSON      map[string]any    // JSON 路径 -> 期望值，如 "data.items[0].id": 1
+	FinalURL  string            // 跟随重定向之后最终的 URL，用来发现 http→https、换域名等变化
+}
+
+// StatusRange 是一个闭区间的状态码范围，单个状态码表示为 Min == Max
+type StatusRange struct {
+	Min, Max int
+}
+
+// defaultStatus 是没有配置状态码断言时的默认期望
+var defaultStatus = []StatusRange{{200, 399}}
+
+// ParseStatusRanges 解析形如 "200,301-302,5xx" 的状态码描述
+func ParseStatusRanges(s string) ([]StatusRange, error) {
+	var ranges []StatusRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseStatusRange(part)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func parseStatusRange(s string) (StatusRange, error) {
+	// 形如 2xx 的写法
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		d, err := strconv.Atoi(s[:1])
+		if err != nil || d < 1 || d > 5 {
+			return StatusRange{}, fmt.Errorf("无效的状态码 %q", s)
+		}
+		return StatusRange{d * 100, d*100 + 99}, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("无效的状态码 %q", s)
+	}
+	max := min
+	if isRange {
+		if max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil || max < min {
+			return StatusRange{}, fmt.Errorf("无效的状态码范围 %q", s)
+		}
+	}
+	return StatusRange{min, max}, nil
+}
+
+func (r StatusRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// needsBody 判断是否需要读取响应体
+func (a *Assertions) needsBody() bool {
+	return a != nil && (a.Body != "" || a.BodyRegex != nil || len(a.JSON) > 0)
+}
+
+// check 对响应执行所有断言，返回每一条失败的原因
+func (a *Assertions) check(resp *http.Response, body []byte) []string {
+	var failures []string
+
+	status := defaultStatus
+	if a != nil && len(a.Status) > 0 {
+		status = a.Status
+	}
+	if !statusMatches(status, resp.StatusCode) {
+		failures = append(failures, fmt.Sprintf("状态码 %d 不在期望范围 %v 内", resp.StatusCode, status))
+	}
+	if a == nil {
+		return failures
+	}
+
+	if a.FinalURL != "" && resp.Request.URL.String() != a.FinalURL {
+		failures = append(failures, fmt.Sprintf("最终 URL 期望 %s, 实际 %s", a.FinalURL, resp.Request.URL))
+	}
+	if a.Body != "" && !strings.Contains(string(body), a.Body) {
+		failures = append(failures, fmt.Sprintf("响应体不包含 %q", a.Body))
+	}
+	if a.BodyRegex != nil && !a.BodyRegex.Match(body) {
+		failures = append(failures, fmt.Sprintf("响应体不匹配正则 %q", a.BodyRegex))
+	}
+	for name, want := range a.Headers {
+		if got := resp.Header.Get(name); got != want {
+			failures = append(failures, fmt.Sprintf("响应头 %s 期望 %q, 实际 %q", name, want, got))
+		}
+	}
+	if len(a.JSON) > 0 {
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return append(failures, fmt.Sprintf("响应体不是合法的 JSON: %v", err))
+		}
+		for path, want := range a.JSON {
+			got, err := lookupJSONPath(doc, path)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("JSON 路径 %s: %v", path, err))
+			} else if !reflect.DeepEqual(got, want) {
+				failures = append(failures, fmt.Sprintf("JSON 路径 %s 期望 %v, 实际 %v", path, want, got))
+			}
+		}
+	}
+	return failures
+}
+
+func statusMatches(ranges []StatusRange, code int) bool {
+	for _, r := range ranges {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupJSONPath 按照 "data.items[0].id" 这样的路径在解码后的 JSON 中取值，
+// 可以带一个可选的 "$." 前缀
+func lookupJSONPath(doc any, path string) (any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	cur := doc
+	for _, seg := range strings.Split(path, ".") {
+		// 先取出字段名，再依次处理后面的 [n] 下标
+		name, rest, _ := strings.Cut(seg, "[")
+		if name != "" {
+			obj, ok := cur.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%q 不是对象", name)
+			}
+			if cur, ok = obj[name]; !ok {
+				return nil, fmt.Errorf("字段 %q 不存在", name)
+			}
+		}
+		for rest != "" {
+			idx, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("路径 %q 缺少 ]", seg)
+			}
+			i, err := strconv.Atoi(idx)
+			if err != nil {
+				return nil, fmt.Errorf("无效的下标 %q", idx)
+			}
+			arr, ok := cur.([]any)
+			if !ok || i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("下标 %d 越界", i)
+			}
+			cur = arr[i]
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return cur, nil
+}
+
+// ParseJSONValue 把文本形式的期望值解析为 JSON 值，解析失败时当作普通字符串。
+// 这样 count=3 会和 JSON 中的数字 3 比较，而 status=ok 会和字符串 "ok" 比较。
+func ParseJSONValue(s string) any {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
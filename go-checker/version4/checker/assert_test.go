@@ -0,0 +1,93 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	ranges, err := ParseStatusRanges("200, 301-302,5xx")
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	want := []StatusRange{{200, 200}, {301, 302}, {500, 599}}
+	if fmt.Sprint(ranges) != fmt.Sprint(want) {
+		t.Errorf("期望 %v, 但得到了 %v", want, ranges)
+	}
+
+	for _, bad := range []string{"abc", "302-301", "9xx"} {
+		if _, err := ParseStatusRanges(bad); err == nil {
+			t.Errorf("%q: 期望得到错误，但没有得到", bad)
+		}
+	}
+}
+
+func TestLookupJSONPath(t *testing.T) {
+	doc := ParseJSONValue(`{"data": {"items": [{"id": 1}, {"id": 2}], "status": "ok"}}`)
+
+	tests := []struct {
+		path string
+		want any
+	}{
+		{"data.status", "ok"},
+		{"$.data.items[1].id", float64(2)},
+	}
+	for _, tt := range tests {
+		got, err := lookupJSONPath(doc, tt.path)
+		if err != nil {
+			t.Errorf("%s: 期望没有错误，但得到了: %v", tt.path, err)
+		} else if got != tt.want {
+			t.Errorf("%s: 期望 %v, 但得到了 %v", tt.path, tt.want, got)
+		}
+	}
+
+	if _, err := lookupJSONPath(doc, "data.items[5].id"); err == nil {
+		t.Error("期望下标越界时得到错误，但没有得到")
+	}
+}
+
+func TestHTTPAssertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/maintenance":
+			fmt.Fprint(w, "系统维护中")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"status": "ok", "count": 3}`)
+		}
+	}))
+	defer server.Close()
+
+	// 没有配置断言时，500 也应该算作失败
+	if res := CheckURL(context.Background(), server.URL+"/down"); res.OK() || len(res.Failures) != 1 {
+		t.Errorf("期望 500 被判定为失败，但得到了 %+v", res)
+	}
+
+	expect := &Assertions{
+		Status:    []StatusRange{{200, 200}},
+		BodyRegex: regexp.MustCompile(`"status":\s*"ok"`),
+		Headers:   map[string]string{"Content-Type": "application/json"},
+		JSON:      map[string]any{"status": "ok", "count": ParseJSONValue("3")},
+	}
+	if res := Check(context.Background(), Target{URL: server.URL + "/health", Expect: expect}); !res.OK() {
+		t.Errorf("期望所有断言通过，但得到了: %v %v", res.Error, res.Failures)
+	}
+
+	// 维护页面返回 200，但是响应头、正则和 JSON 断言都不满足
+	res := Check(context.Background(), Target{URL: server.URL + "/maintenance", Expect: expect})
+	if res.OK() {
+		t.Fatal("期望维护页面被判定为失败")
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("期望状态码 %d, 但得到了 %d", http.StatusOK, res.StatusCode)
+	}
+	if len(res.Failures) != 3 {
+		t.Errorf("期望 3 条失败原因，但得到了 %d 条: %v", len(res.Failures), res.Failures)
+	}
+}
@@ -0,0 +1,206 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrHostDown 是熔断器断开时被跳过的目标的错误，这些目标没有真正检查
+var ErrHostDown = errors.New("skipped: host down")
+
+// HostDownError 是被跳过的结果的具体错误，errors.Is(err, ErrHostDown) 为 true
+type HostDownError struct {
+	Host     string // 熔断的主机，格式为 host:port
+	Failures int    // 熔断时连续失败的次数
+}
+
+func (e *HostDownError) Error() string {
+	return fmt.Sprintf("%v: %s 连续 %d 次连接失败", ErrHostDown, e.Host, e.Failures)
+}
+
+func (e *HostDownError) Unwrap() error {
+	return ErrHostDown
+}
+
+// DefaultBreakerThreshold 是 BreakerPolicy.Threshold 为 0 时的默认值
+const DefaultBreakerThreshold = 5
+
+// BreakerPolicy 是按主机的熔断器。主机按 host:port 区分，没写端口时使用 scheme 的默认端口，
+// 同一台机器上的不同服务互不影响。一个主机连续 Threshold 次连接失败
+// （超时、连接被拒绝、域名解析失败等）之后，认为它已经挂了，
+// 这个主机剩下的目标不再检查，直接返回 ErrHostDown 的结果，不用每个都等到超时。
+// Cooldown 大于 0 时，断开 Cooldown 之后进入半开状态，放一个检查过去试探：
+// 成功（包括收到任何 HTTP 响应）就恢复，失败就再断开 Cooldown。
+// Cooldown 为 0 时断开之后在这次运行中不再恢复，适合单次运行；监控模式应该设置 Cooldown。
+type BreakerPolicy struct {
+	Threshold int           // 连续多少次连接失败后断开，为 0 时使用 DefaultBreakerThreshold
+	Cooldown  time.Duration // 断开多久之后试探，为 0 时不试探
+	// OnChange 在熔断器状态变化时调用，在 worker 的 goroutine 中并发执行
+	OnChange func(e BreakerEvent)
+}
+
+// 熔断器的状态
+const (
+	BreakerClosed   = "closed"    // 正常检查
+	BreakerOpen     = "open"      // 跳过这个主机的目标
+	BreakerHalfOpen = "half_open" // 正在用一个检查试探主机是否恢复
+)
+
+// BreakerEvent 是一个主机的熔断器的一次状态变化
+type BreakerEvent struct {
+	At       time.Time
+	Host     string
+	From, To string // 见上面的 Breaker 常量
+	Failures int    // 到这次变化为止连续失败的次数
+	Error    error  // 最后一次连接失败的原因，恢复时为 nil
+}
+
+// breakerState 是一个主机的熔断器
+type breakerState struct {
+	state    string
+	failures int
+	lastErr  error
+	openedAt time.Time
+}
+
+// breakerSet 保存每个主机的熔断器，为 nil 时不熔断
+type breakerSet struct {
+	policy BreakerPolicy
+	mu     sync.Mutex
+	hosts  map[string]*breakerState
+}
+
+func newBreakerSet(p *BreakerPolicy) *breakerSet {
+	if p == nil {
+		return nil
+	}
+	b := &breakerSet{policy: *p, hosts: make(map[string]*breakerState)}
+	if b.policy.Threshold <= 0 {
+		b.policy.Threshold = DefaultBreakerThreshold
+	}
+	return b
+}
+
+// defaultPorts 是各个 scheme 没写端口时连接的端口
+var defaultPorts = map[string]string{"http": "80", "https": "443", "tls": "443"}
+
+// breakerKey 返回目标所属的服务，格式为 host:port，没写端口时使用 scheme 的默认端口，
+// 所以 http://h 和 http://h:80 是同一个服务，http://h 和 https://h 不是。
+// 和限速的 hostKey 不同：限速保护的是整台机器，而一个端口连不上不代表同一台机器上的其他服务也挂了。
+// URL 无效时返回空字符串（不熔断）
+func breakerKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return ServiceKey(u)
+}
+
+// ServiceKey 返回 URL 指向的服务 host:port：主机名转成小写，没写端口时使用 scheme 的默认端口。
+// 两个 URL 的 ServiceKey 相同就是同一个服务，如 https://Example.com 和 https://example.com:443
+func ServiceKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	host := strings.ToLower(u.Hostname())
+	if port == "" { // 如 dns://，没有端口可言
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// connFailure 判断结果是不是连不上主机造成的失败。
+// 收到了 HTTP 响应（哪怕是 500）或者断言失败都说明主机还活着；证书错误是配置问题，重试也一样，不算
+func connFailure(res Result) bool {
+	switch res.Category() {
+	case CategoryTimeout, CategoryRefused, CategoryNetwork, CategoryDNS:
+		return true
+	}
+	return false
+}
+
+// allow 判断现在能不能检查 t，不能的话返回一个跳过的结果。
+// probe 为 true 表示这是半开状态下的试探，检查完之后必须交给 record
+func (b *breakerSet) allow(t Target, now time.Time) (probe bool, skipped *Result) {
+	if b == nil {
+		return false, nil
+	}
+	host := breakerKey(t.URL)
+	if host == "" {
+		return false, nil
+	}
+	b.mu.Lock()
+	h, ok := b.hosts[host]
+	if !ok || h.state == BreakerClosed {
+		b.mu.Unlock()
+		return false, nil
+	}
+	if h.state == BreakerOpen && b.policy.Cooldown > 0 && now.Sub(h.openedAt) >= b.policy.Cooldown {
+		h.state = BreakerHalfOpen
+		e := BreakerEvent{At: now, Host: host, From: BreakerOpen, To: BreakerHalfOpen, Failures: h.failures, Error: h.lastErr}
+		b.mu.Unlock()
+		b.notify(e)
+		return true, nil
+	}
+	res := Result{URL: t.URL, Name: t.Name, Tags: t.Tags, FoundOn: t.FoundOn,
+		Error: &HostDownError{Host: host, Failures: h.failures}}
+	b.mu.Unlock()
+	return false, &res
+}
+
+// record 根据检查结果更新主机的熔断器
+func (b *breakerSet) record(t Target, res Result, probe bool, now time.Time) {
+	if b == nil {
+		return
+	}
+	host := breakerKey(t.URL)
+	if host == "" {
+		return
+	}
+	b.mu.Lock()
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &breakerState{state: BreakerClosed}
+	}
+	from := h.state
+	switch {
+	case res.Category() == CategoryCanceled || res.Category() == CategoryInvalidTarget:
+		// 没有说明主机的情况。被取消的试探让主机回到断开状态，下一个目标再试探
+		if probe {
+			h.state = BreakerOpen
+		}
+	case connFailure(res):
+		h.failures++
+		h.lastErr = res.Error
+		if h.state == BreakerHalfOpen || h.state == BreakerClosed && h.failures >= b.policy.Threshold {
+			h.state, h.openedAt = BreakerOpen, now
+		}
+	default:
+		// 主机有响应，连续失败的计数清零。断开之前已经开始的检查成功了也说明主机恢复了
+		h.failures, h.lastErr = 0, nil
+		h.state = BreakerClosed
+	}
+	// 只保存有过失败的主机，正常的主机不占内存
+	if h.state == BreakerClosed && h.failures == 0 {
+		delete(b.hosts, host)
+	} else {
+		b.hosts[host] = h
+	}
+	e := BreakerEvent{At: now, Host: host, From: from, To: h.state, Failures: h.failures, Error: h.lastErr}
+	b.mu.Unlock()
+	if from != e.To {
+		b.notify(e)
+	}
+}
+
+func (b *breakerSet) notify(e BreakerEvent) {
+	if b.policy.OnChange != nil {
+		b.policy.OnChange(e)
+	}
+}
@@ -0,0 +1,114 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// closedPort 返回一个没有监听的本地地址，连接它会被拒绝
+func closedPort(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestBreakerRun(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	upURL := strings.Replace(up.URL, "127.0.0.1", "localhost", 1)
+
+	down := "http://" + closedPort(t)
+	var targets []Target
+	for range 10 {
+		targets = append(targets, Target{URL: down}, Target{URL: upURL})
+	}
+	var events []BreakerEvent
+	opts := Options{Concurrency: 1, Breaker: &BreakerPolicy{Threshold: 3, OnChange: func(e BreakerEvent) {
+		events = append(events, e) // Concurrency 为 1，不需要加锁
+	}}}
+
+	counts := make(map[string]int)
+	for res := range Run(context.Background(), targets, opts) {
+		counts[res.Category()]++
+	}
+	if counts[CategoryRefused] != 3 || counts[CategorySkipped] != 7 || counts[""] != 10 {
+		t.Errorf("期望 3 个连接被拒绝、7 个跳过、10 个成功, 但得到了 %v", counts)
+	}
+	if len(events) != 1 || events[0].Host != strings.TrimPrefix(down, "http://") || events[0].To != BreakerOpen || events[0].Failures != 3 {
+		t.Errorf("期望 %s 熔断一次, 但得到了 %+v", down, events)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := newBreakerSet(&BreakerPolicy{Threshold: 2, Cooldown: time.Minute})
+	target := Target{URL: "http://example.com/a"}
+	refused := Result{Error: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}
+	now := time.Now()
+
+	for range 2 {
+		if probe, skipped := b.allow(target, now); probe || skipped != nil {
+			t.Fatal("期望熔断之前正常检查")
+		}
+		b.record(target, refused, false, now)
+	}
+	_, skipped := b.allow(Target{URL: "http://EXAMPLE.com/b"}, now)
+	var hostDown *HostDownError
+	if skipped == nil || !errors.As(skipped.Error, &hostDown) || hostDown.Host != "example.com:80" || skipped.Category() != CategorySkipped {
+		t.Fatalf("期望同一个主机的其他目标被跳过, 但得到了 %+v", skipped)
+	}
+
+	// 冷却时间到了之后只放一个试探过去，试探失败就再断开一个冷却时间
+	now = now.Add(time.Minute)
+	if probe, skipped := b.allow(target, now); !probe || skipped != nil {
+		t.Fatal("期望冷却之后试探一次")
+	}
+	if _, skipped := b.allow(target, now); skipped == nil {
+		t.Error("期望试探还没有结果时其他目标仍然被跳过")
+	}
+	b.record(target, refused, true, now)
+	if _, skipped := b.allow(target, now.Add(time.Second)); skipped == nil {
+		t.Error("期望试探失败之后重新熔断")
+	}
+
+	// 试探收到了响应（即使是 500）就恢复
+	now = now.Add(time.Minute)
+	if probe, _ := b.allow(target, now); !probe {
+		t.Fatal("期望冷却之后再试探一次")
+	}
+	b.record(target, Result{StatusCode: 500, Failures: []string{"状态码 500"}}, true, now)
+	if probe, skipped := b.allow(target, now); probe || skipped != nil {
+		t.Error("期望试探收到响应之后恢复正常检查")
+	}
+}
+
+func TestBreakerKey(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"http://Example.com/a", "example.com:80"},
+		{"http://example.com:80/b", "example.com:80"},
+		{"https://example.com", "example.com:443"},
+		{"http://example.com:8080", "example.com:8080"},
+		{"tcp://example.com:5432", "example.com:5432"},
+		{"tls://example.com", "example.com:443"},
+		{"http://[::1]/", "[::1]:80"},
+		{"dns://example.com", "example.com"},
+		{"://bad", ""},
+	}
+	for _, tt := range tests {
+		if got := breakerKey(tt.url); got != tt.want {
+			t.Errorf("breakerKey(%q): 期望 %q, 但得到了 %q", tt.url, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelMarksRemainingTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(50*time.Millisecond, func() { cancel(errors.New("收到信号 interrupt")) })
+
+	// 只有一个 worker：第一个请求进行到一半被取消，后面的目标根本不会被检查
+	const n = 5
+	targets := make([]Target, n)
+	for i := range targets {
+		targets[i] = Target{URL: server.URL}
+	}
+
+	start := time.Now()
+	var all []Result
+	for res := range Run(ctx, targets, Options{Concurrency: 1}) {
+		all = append(all, res)
+	}
+	if len(all) != n {
+		t.Fatalf("期望 %d 个结果, 但得到了 %d 个", n, len(all))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("期望取消后立即返回, 但用了 %v", elapsed)
+	}
+	for _, res := range all {
+		if res.Category() != CategoryCanceled || !strings.Contains(res.Error.Error(), "interrupt") {
+			t.Errorf("期望结果被标记为已取消并带有原因, 但得到了 %v", res.Error)
+		}
+	}
+}
+
+func TestCancelStopsRetryWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	p := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute, RetryOn: DefaultRetryOn}
+	start := time.Now()
+	res := Check(ctx, Target{URL: "tcp://127.0.0.1:1", Retry: p})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("期望取消后不再等待重试, 但用了 %v", elapsed)
+	}
+	if res.Attempts != 1 || res.Category() != CategoryCanceled {
+		t.Errorf("期望只尝试 1 次并标记为已取消, 但得到了 %d 次 %v", res.Attempts, res.Error)
+	}
+}
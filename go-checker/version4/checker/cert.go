@@ -0,0 +1,100 @@
+package checker
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCertWarn 是默认的证书过期警告阈值：剩余有效期不足 14 天时给出警告
+const DefaultCertWarn = 14 * 24 * time.Hour
+
+// CertInfo 是 HTTPS 或 TLS 检查时对端证书的信息
+type CertInfo struct {
+	Subject       string
+	Issuer        string
+	DNSNames      []string // 证书中的 SAN（Subject Alternative Name）
+	NotBefore     time.Time
+	NotAfter      time.Time // 叶子证书的过期时间
+	ChainExpiry   time.Time // 证书链中最早的过期时间，中间证书过期同样会导致访问失败
+	HostnameMatch bool      // 证书是否和访问的域名匹配
+}
+
+// inspectCert 从 TLS 连接状态中提取证书信息，没有证书时返回 nil。
+// 知识点：PeerCertificates 是服务器发来的证书链，第一个是叶子证书，后面是中间证书。
+func inspectCert(state *tls.ConnectionState, host string) *CertInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := state.PeerCertificates[0]
+	info := &CertInfo{
+		Subject:       leaf.Subject.String(),
+		Issuer:        leaf.Issuer.String(),
+		DNSNames:      leaf.DNSNames,
+		NotBefore:     leaf.NotBefore,
+		NotAfter:      leaf.NotAfter,
+		ChainExpiry:   leaf.NotAfter,
+		HostnameMatch: leaf.VerifyHostname(host) == nil,
+	}
+	for _, c := range state.PeerCertificates[1:] {
+		if c.NotAfter.Before(info.ChainExpiry) {
+			info.ChainExpiry = c.NotAfter
+		}
+	}
+	return info
+}
+
+// evaluate 检查证书的有效期和域名。已经过期（或还没生效）算失败，
+// 剩余有效期少于 warn 或域名不匹配算警告，warn 小于等于 0 时不检查有效期。
+// 正常校验证书时这些问题在握手阶段就会报错，只有跳过校验（insecure）时才会走到这里。
+func (c *CertInfo) evaluate(warn time.Duration, now time.Time) (warnings, failures []string) {
+	if c == nil {
+		return nil, nil
+	}
+	switch {
+	case now.After(c.ChainExpiry):
+		failures = append(failures, fmt.Sprintf("证书已于 %s 过期", c.ChainExpiry.Format(time.DateOnly)))
+	case now.Before(c.NotBefore):
+		failures = append(failures, fmt.Sprintf("证书要到 %s 才生效", c.NotBefore.Format(time.DateOnly)))
+	case warn > 0 && c.ChainExpiry.Sub(now) < warn:
+		warnings = append(warnings, fmt.Sprintf("证书将在 %s 后过期（%s）",
+			formatDays(c.ChainExpiry.Sub(now)), c.ChainExpiry.Format(time.DateOnly)))
+	}
+	if !c.HostnameMatch {
+		warnings = append(warnings, fmt.Sprintf("证书与域名不匹配，证书中的域名: %s", strings.Join(c.DNSNames, ",")))
+	}
+	return warnings, failures
+}
+
+// checkCert 把证书检查的结果合并到 res 中
+func checkCert(t Target, res *Result) {
+	warnings, failures := res.Cert.evaluate(t.CertWarn, time.Now())
+	res.Warnings = append(res.Warnings, warnings...)
+	res.Failures = append(res.Failures, failures...)
+}
+
+// formatDays 把时间长度显示成天数，不足一天时显示小时
+func formatDays(d time.Duration) string {
+	if d < 24*time.Hour {
+		return d.Truncate(time.Minute).String()
+	}
+	return fmt.Sprintf("%d 天", int(d/(24*time.Hour)))
+}
+
+// ParseCertWarn 解析证书过期警告阈值，除了 time.ParseDuration 支持的格式外，还支持 "14d" 这样的天数
+func ParseCertWarn(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("无效的证书过期警告阈值 %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的证书过期警告阈值 %q", s)
+	}
+	return d, nil
+}
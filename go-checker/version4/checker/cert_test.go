@@ -0,0 +1,106 @@
+package checker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCertServer 启动一个使用自签名证书的 HTTPS 服务器，证书在 notAfter 过期
+func newCertServer(t *testing.T, notAfter time.Time, dnsNames []string, ips ...net.IP) *httptest.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "go-checker test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // 客户端拒绝证书时服务器会打印握手错误
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCertExpiryWarning(t *testing.T) {
+	server := newCertServer(t, time.Now().Add(3*24*time.Hour), []string{"example.com"}, net.ParseIP("127.0.0.1"))
+
+	res := Check(context.Background(), Target{URL: server.URL, Insecure: true, CertWarn: DefaultCertWarn})
+	if !res.OK() || !res.Warn() {
+		t.Fatalf("期望检查成功并带有警告, 但得到了 %v %v %v", res.Error, res.Failures, res.Warnings)
+	}
+	if res.Cert == nil || !res.Cert.HostnameMatch || res.Cert.DNSNames[0] != "example.com" {
+		t.Errorf("证书信息错误: %+v", res.Cert)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "证书将在") {
+		t.Errorf("期望证书即将过期的警告, 但得到了 %v", res.Warnings)
+	}
+
+	// 阈值小于剩余有效期时不应该警告
+	if res := Check(context.Background(), Target{URL: server.URL, Insecure: true, CertWarn: 24 * time.Hour}); res.Warn() {
+		t.Errorf("期望没有警告, 但得到了 %v", res.Warnings)
+	}
+}
+
+func TestCertHostnameMismatch(t *testing.T) {
+	server := newCertServer(t, time.Now().Add(365*24*time.Hour), []string{"example.com"})
+	tlsURL := "tls://" + server.Listener.Addr().String()
+
+	res := Check(context.Background(), Target{URL: tlsURL, Insecure: true, CertWarn: DefaultCertWarn})
+	if !res.Warn() || res.Cert.HostnameMatch {
+		t.Fatalf("期望域名不匹配的警告, 但得到了 %v %v", res.Error, res.Warnings)
+	}
+
+	// 不跳过校验时，自签名证书在握手阶段就会失败
+	res = Check(context.Background(), Target{URL: tlsURL})
+	if res.OK() || res.Category() != CategoryTLS {
+		t.Errorf("期望证书校验失败, 但得到了 %v", res.Error)
+	}
+}
+
+func TestCertExpired(t *testing.T) {
+	info := &CertInfo{NotBefore: time.Now().Add(-48 * time.Hour), ChainExpiry: time.Now().Add(-time.Hour), HostnameMatch: true}
+	warnings, failures := info.evaluate(DefaultCertWarn, time.Now())
+	if len(warnings) != 0 || len(failures) != 1 {
+		t.Errorf("期望过期的证书算作失败, 但得到了 %v %v", warnings, failures)
+	}
+}
+
+func TestParseCertWarn(t *testing.T) {
+	tests := map[string]time.Duration{"14d": 14 * 24 * time.Hour, "72h": 72 * time.Hour, "0": 0}
+	for s, want := range tests {
+		if got, err := ParseCertWarn(s); err != nil || got != want {
+			t.Errorf("ParseCertWarn(%q): 期望 %v, 但得到了 %v %v", s, want, got, err)
+		}
+	}
+	if _, err := ParseCertWarn("-1d"); err == nil {
+		t.Error("期望负数返回错误")
+	}
+}
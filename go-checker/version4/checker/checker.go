@@ -0,0 +1,349 @@
+// Package checker 实现了对 HTTP、TCP、DNS、TLS 目标的检查，以及并发检查一组目标的 worker 池。
+//
+// 最简单的用法是把目标交给 Run，然后读取结果：
+//
+//	targets := []checker.Target{{URL: "https://example.com"}, {URL: "tcp://example.com:22"}}
+//	for res := range checker.Run(ctx, targets, checker.Options{Concurrency: 4}) {
+//		fmt.Println(res.URL, res.OK(), res.Category())
+//	}
+//
+// 知识点：把可复用的逻辑放进单独的包，main 包只负责解析参数和输出，
+// 包内小写开头的标识符对外不可见，这样就能自由调整内部实现而不影响调用者。
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout 是每次检查的默认超时时间
+const DefaultTimeout = 5 * time.Second
+
+var (
+	ErrInvalidTarget     = errors.New("无效的目标地址")
+	ErrUnsupportedScheme = errors.New("不支持的协议")
+	ErrCanceled          = errors.New("检查被取消")
+)
+
+// Checker 是所有检查方式的统一接口。
+// 知识点：Go 的接口是隐式实现的，任何拥有 Check 方法的类型都自动满足 Checker，
+// 这样 worker 只需要面向接口编程，不用关心具体是 HTTP、TCP 还是 DNS 检查。
+// ctx 被取消时（如按下 Ctrl-C）Check 应该尽快返回。
+type Checker interface {
+	Check(ctx context.Context, t Target) Result
+}
+
+// Target 是一个待检查的目标，Method、Headers、Body 和 Expect 只对 HTTP 检查生效
+type Target struct {
+	Name     string
+	URL      string
+	Method   string // 为空时使用 GET
+	Headers  map[string]string
+	Body     string
+	Timeout  time.Duration // 为 0 时使用 DefaultTimeout
+	Tags     []string
+	Interval time.Duration // 监控模式下的检查间隔，为 0 时由调用者决定
+	Expect   *Assertions
+	Retry    *RetryPolicy    // 为 nil 时只检查一次
+	Redirect *RedirectPolicy // 为 nil 时最多跟随 10 次重定向
+	// CertWarn 是 https 和 tls 目标的证书过期警告阈值，不大于 0 时不检查即将过期，已经过期的证书总是算作失败
+	CertWarn  time.Duration
+	Insecure  bool       // 跳过证书校验，但仍然会检查证书的有效期和域名
+	HostLimit *HostLimit // 对这个目标所在主机的限制，为 nil 时使用 Options.HostLimit
+	// FreshConn 为 true 时不复用连接，每次检查都重新建立，测到的延迟包括 DNS、TCP 和 TLS 握手
+	FreshConn bool
+	// 以下两项只在爬取模式下使用
+	FoundOn      string // 发现这个链接的页面
+	CollectLinks bool   // 是否解析响应中的链接，放到 Result.Links 中
+}
+
+// timeout 返回这个目标实际使用的超时时间
+func (t Target) timeout() time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
+	}
+	return DefaultTimeout
+}
+
+// IsHTTP 判断目标是否是 http:// 或 https:// 地址
+func (t Target) IsHTTP() bool {
+	c, err := CheckerFor(t.URL)
+	_, ok := c.(HTTPChecker)
+	return err == nil && ok
+}
+
+// registry 按 URL 的 scheme 注册对应的 Checker
+type registry map[string]Checker
+
+var defaultCheckers = registry{
+	"http":  HTTPChecker{},
+	"https": HTTPChecker{},
+	"tcp":   TCPChecker{},
+	"dns":   DNSChecker{},
+	"tls":   TLSChecker{},
+}
+
+// CheckerFor 根据 URL 的 scheme 选出对应的 Checker，可以用来提前校验目标地址
+func CheckerFor(rawURL string) (Checker, error) {
+	return defaultCheckers.lookup(rawURL)
+}
+
+func (r registry) lookup(rawURL string) (Checker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	c, ok := r[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedScheme, u.Scheme)
+	}
+	return c, nil
+}
+
+// Check 选择合适的 Checker 检查一个目标，失败时按照目标的重试策略重试。
+// ctx 已经被取消时不再检查，直接返回一个被取消的结果。
+func Check(ctx context.Context, t Target) Result {
+	return defaultCheckers.check(ctx, t)
+}
+
+func (r registry) check(ctx context.Context, t Target) Result {
+	if ctx.Err() != nil {
+		return Result{URL: t.URL, Name: t.Name, Tags: t.Tags, FoundOn: t.FoundOn, Error: canceledError(ctx)}
+	}
+	c, err := r.lookup(t.URL)
+	if err != nil {
+		return Result{URL: t.URL, Name: t.Name, Tags: t.Tags, FoundOn: t.FoundOn, Attempts: 1, Error: err}
+	}
+	result := t.Retry.run(ctx, func() Result { return c.Check(ctx, t) })
+	// 检查途中被取消，失败是取消造成的，不是目标本身的问题
+	if ctx.Err() != nil && !result.OK() {
+		result.Error = canceledError(ctx)
+	}
+	result.URL = t.URL
+	result.Name = t.Name
+	result.Tags = t.Tags
+	result.FoundOn = t.FoundOn
+	return result
+}
+
+// canceledError 返回带有取消原因的 ErrCanceled，原因来自 context.Cause，如 Ctrl-C 或者超过了总时长
+func canceledError(ctx context.Context) error {
+	return fmt.Errorf("%w: %v", ErrCanceled, context.Cause(ctx))
+}
+
+// CheckURL 使用默认设置检查一个 URL
+func CheckURL(ctx context.Context, rawURL string) Result {
+	return Check(ctx, Target{URL: rawURL})
+}
+
+// HTTPChecker 发起 HTTP 请求，对应 http:// 和 https://。
+// Client 为 nil 时使用包内共享的 Transport（见 NewTransport）；否则使用它的 Transport 和 Jar，
+// 超时和重定向仍然按照目标自己的设置。
+// 知识点：http.Client 只是 Transport 外面很薄的一层，每次检查新建一个 Client 没有什么开销，
+// 只要 Transport 是共享的，连接就能在检查之间复用。
+type HTTPChecker struct {
+	Client *http.Client
+}
+
+func (h HTTPChecker) Check(ctx context.Context, t Target) Result {
+	req, err := newRequest(ctx, t)
+	if err != nil {
+		return Result{Kind: "http", Error: err}
+	}
+	tracer := &phaseTracer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), tracer.trace()))
+
+	transport, jar := h.transport(t)
+	// 只有 *http.Transport 才能修改连接复用的设置，自定义的 RoundTripper 只能让服务器在响应后关闭连接
+	if base, ok := transport.(*http.Transport); ok && t.FreshConn {
+		base = freshTransport(base)
+		defer base.CloseIdleConnections()
+		transport = base
+	} else if t.FreshConn {
+		req.Close = true
+	}
+	hops := &hopRecorder{next: transport}
+	client := http.Client{
+		Timeout:       t.timeout(), // 一定要设置超时，默认5秒
+		Transport:     hops,
+		CheckRedirect: t.Redirect.checkRedirect,
+		Jar:           jar,
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+
+	if err != nil {
+		timing := tracer.result()
+		return Result{Kind: "http", Timing: &timing, Hops: hops.hops, Error: err}
+	}
+	defer resp.Body.Close()
+
+	result := Result{Kind: "http", StatusCode: resp.StatusCode, Latency: latency, Hops: hops.hops}
+	received := time.Now()
+	collectLinks := t.CollectLinks && isHTML(resp)
+	body, err := readBody(resp.Body, t.Expect.needsBody() || collectLinks)
+	timing := tracer.finish(received)
+	result.Timing = &timing
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.Failures = t.Expect.check(resp, body)
+	if collectLinks {
+		result.Links = extractLinks(body, resp.Request.URL) // 相对链接要按重定向之后的地址解析
+	}
+	// 发生重定向时 resp 是最后一个请求的响应，证书也是最后一个地址的
+	result.Cert = inspectCert(resp.TLS, resp.Request.URL.Hostname())
+	checkCert(t, &result)
+	return result
+}
+
+// Fetch 按照 t 的请求头、超时、Insecure 和重定向设置，用和 Check 相同的 Transport 发出请求，
+// 直接返回响应，不做断言和计时，调用者负责关闭响应体。
+// 用于爬取时下载 robots.txt 这类需要自己处理内容的请求
+func (h HTTPChecker) Fetch(ctx context.Context, t Target) (*http.Response, error) {
+	req, err := newRequest(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	transport, jar := h.transport(t)
+	client := http.Client{Timeout: t.timeout(), Transport: transport, CheckRedirect: t.Redirect.checkRedirect, Jar: jar}
+	return client.Do(req)
+}
+
+// newRequest 按照 t 的方法、请求体和请求头创建请求
+func newRequest(ctx context.Context, t Target) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, t.Method, t.URL, strings.NewReader(t.Body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range t.Headers {
+		req.Header.Set(name, value)
+	}
+	// Host 头比较特殊，必须设置在 req.Host 上才会生效
+	if host, ok := t.Headers["Host"]; ok {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// transport 返回请求 t 使用的 Transport 和 Jar。
+// 只有 *http.Transport 才能修改 TLS 设置，自定义的 RoundTripper 需要自己处理 Insecure
+func (h HTTPChecker) transport(t Target) (http.RoundTripper, http.CookieJar) {
+	var transport http.RoundTripper = sharedTransport
+	var jar http.CookieJar
+	if h.Client != nil {
+		if h.Client.Transport != nil {
+			transport = h.Client.Transport
+		}
+		jar = h.Client.Jar
+	}
+	if base, ok := transport.(*http.Transport); ok && t.Insecure {
+		transport = insecureTransport(base)
+	}
+	return transport, jar
+}
+
+// readBody 读完整个响应体，这样才能测出下载耗时。
+// keep 为 true 时返回前 MaxAssertBody 个字节用于断言，其余部分直接丢弃。
+func readBody(r io.Reader, keep bool) ([]byte, error) {
+	if !keep {
+		_, err := io.Copy(io.Discard, r)
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(r, MaxAssertBody))
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(io.Discard, r)
+	return body, err
+}
+
+// TCPChecker 只建立一次 TCP 连接，适合检查数据库、消息队列等非 HTTP 服务，
+// 对应 tcp://host:port
+type TCPChecker struct{}
+
+func (TCPChecker) Check(ctx context.Context, t Target) Result {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return Result{Kind: "tcp", Error: err}
+	}
+	if u.Port() == "" {
+		return Result{Kind: "tcp", Error: fmt.Errorf("%w: tcp 地址缺少端口: %s", ErrInvalidTarget, u.Host)}
+	}
+	start := time.Now()
+	dialer := &net.Dialer{Timeout: t.timeout()}
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	latency := time.Since(start)
+	if err != nil {
+		return Result{Kind: "tcp", Error: err}
+	}
+	defer conn.Close()
+
+	return Result{Kind: "tcp", Latency: latency, Detail: conn.RemoteAddr().String()}
+}
+
+// DNSChecker 解析域名，对应 dns://name
+type DNSChecker struct{}
+
+func (DNSChecker) Check(ctx context.Context, t Target) Result {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return Result{Kind: "dns", Error: err}
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+	latency := time.Since(start)
+	if err != nil {
+		return Result{Kind: "dns", Error: err}
+	}
+
+	return Result{Kind: "dns", Latency: latency, Detail: strings.Join(addrs, ",")}
+}
+
+// TLSChecker 完成一次 TLS 握手（包括证书校验），对应 tls://host:443
+type TLSChecker struct{}
+
+func (TLSChecker) Check(ctx context.Context, t Target) Result {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return Result{Kind: "tls", Error: err}
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: t.timeout()},
+		Config:    &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: t.Insecure},
+	}
+	// 知识点：net.Dialer 的 Timeout 只管建立 TCP 连接，握手也要算在超时内，所以再套一层 context
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	latency := time.Since(start)
+	if err != nil {
+		return Result{Kind: "tls", Error: err}
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	result := Result{Kind: "tls", Latency: latency, Detail: tls.VersionName(state.Version), Cert: inspectCert(&state, u.Hostname())}
+	checkCert(t, &result)
+	return result
+}
@@ -0,0 +1,119 @@
+package checker
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckerForScheme(t *testing.T) {
+	tests := []struct {
+		url  string
+		want Checker
+	}{
+		{"http://example.com", HTTPChecker{}},
+		{"https://example.com", HTTPChecker{}},
+		{"tcp://127.0.0.1:3306", TCPChecker{}},
+		{"dns://example.com", DNSChecker{}},
+		{"tls://example.com:443", TLSChecker{}},
+	}
+	for _, tt := range tests {
+		c, err := CheckerFor(tt.url)
+		if err != nil {
+			t.Errorf("%s: 期望没有错误，但得到了: %v", tt.url, err)
+			continue
+		}
+		if c != tt.want {
+			t.Errorf("%s: 期望 %T, 但得到了 %T", tt.url, tt.want, c)
+		}
+	}
+
+	if _, err := CheckerFor("ftp://example.com"); err == nil {
+		t.Error("期望不支持的协议返回错误，但没有得到")
+	}
+}
+
+func TestTCPChecker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	result := CheckURL(context.Background(), "tcp://"+ln.Addr().String())
+	if result.Error != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", result.Error)
+	}
+	if result.Kind != "tcp" {
+		t.Errorf("期望类型 tcp, 但得到了 %s", result.Kind)
+	}
+
+	// 缺少端口的地址应该直接报错
+	if res := CheckURL(context.Background(), "tcp://127.0.0.1"); res.Error == nil {
+		t.Error("期望缺少端口时得到错误，但没有得到")
+	}
+}
+
+func TestDNSChecker(t *testing.T) {
+	result := CheckURL(context.Background(), "dns://localhost")
+	if result.Error != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", result.Error)
+	}
+	if result.Detail == "" {
+		t.Error("期望得到解析出的地址")
+	}
+}
+
+func TestTLSChecker(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // 握手失败是预期的，不打印日志
+	server.StartTLS()
+	defer server.Close()
+
+	// httptest 使用自签名证书，握手时的证书校验应该失败
+	result := CheckURL(context.Background(), strings.Replace(server.URL, "https://", "tls://", 1))
+	if result.Error == nil {
+		t.Error("期望自签名证书校验失败，但没有得到错误")
+	}
+	if result.Kind != "tls" {
+		t.Errorf("期望类型 tls, 但得到了 %s", result.Kind)
+	}
+}
+
+func TestHTTPCheckerRequestOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("X-Token") != "abc" || string(body) != "ping" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	result := Check(context.Background(), Target{
+		Name:    "api",
+		URL:     server.URL,
+		Method:  http.MethodPost,
+		Headers: map[string]string{"X-Token": "abc"},
+		Body:    "ping",
+	})
+	if !result.OK() {
+		t.Errorf("期望请求方法、请求头和请求体都被发送, 但得到了 %d %v", result.StatusCode, result.Failures)
+	}
+	if result.Name != "api" {
+		t.Errorf("期望结果带上目标名称 api, 但得到了 %q", result.Name)
+	}
+}
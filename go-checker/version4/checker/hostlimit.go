@@ -0,0 +1,290 @@
+package checker
+
+import (
+	"container/heap"
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimit 限制对同一个主机的检查：RPS 是令牌桶的速率，Burst 是桶的容量，
+// MaxConcurrent 是同时进行的检查数。零值表示不限制。
+type HostLimit struct {
+	RPS           float64 // 每秒最多开始几个检查，为 0 时不限制
+	Burst         int     // 最多可以连续开始几个检查，为 0 时为 1
+	MaxConcurrent int     // 同时最多几个检查，为 0 时不限制
+}
+
+func (l HostLimit) limited() bool {
+	return l.RPS > 0 || l.MaxConcurrent > 0
+}
+
+// maxQueued 是调度器最多暂存的目标数。达到这个数之后不再读取新的目标，
+// 直到有目标被发给 worker，这样目标列表再长内存占用也有上限。
+const maxQueued = 10000
+
+// hostState 是一个主机的排队和限流状态
+type hostState struct {
+	key     string
+	limit   HostLimit
+	queue   []job     // 等待发给 worker 的目标，按序号排列
+	active  int       // 正在检查的数量
+	tokens  float64   // 令牌桶中剩余的令牌
+	last    time.Time // tokens 上次更新的时间
+	index   int       // 在 ready 堆中的位置，-1 表示不在堆中
+	waiting bool      // 已经在 timers 堆中等待令牌
+}
+
+// refill 按经过的时间往桶里加令牌
+func (h *hostState) refill(now time.Time) {
+	burst := float64(max(h.limit.Burst, 1))
+	h.tokens = min(burst, h.tokens+now.Sub(h.last).Seconds()*h.limit.RPS)
+	h.last = now
+}
+
+// canStart 判断现在能不能再开始一个检查，不能的话 wait 是还要等多久才有令牌（只受并发限制时为 0）
+func (h *hostState) canStart(now time.Time) (ok bool, wait time.Duration) {
+	if h.limit.MaxConcurrent > 0 && h.active >= h.limit.MaxConcurrent {
+		return false, 0
+	}
+	if h.limit.RPS > 0 {
+		h.refill(now)
+		if h.tokens < 1 {
+			return false, time.Duration((1 - h.tokens) / h.limit.RPS * float64(time.Second))
+		}
+	}
+	return true, 0
+}
+
+// hostScheduler 位于 targets 和 worker 之间，按主机排队：
+// 受限的主机的目标在队列里等令牌或者等并发名额，而不是占着 worker 等，
+// 所以一个主机被限速时，其他主机的目标照样可以被 worker 拿走。
+// 可以开始的主机中，队首序号最小的先发，没有限制时就是按读到的顺序。
+type hostScheduler struct {
+	defaults HostLimit
+	canceled bool // ctx 被取消之后不再限制，让 worker 尽快返回被取消的结果
+
+	mu       sync.Mutex
+	hosts    map[string]*hostState
+	ready    readyHeap    // 队首的目标现在就可以开始的主机
+	timers   timerHeap    // 在等令牌的主机
+	released []*hostState // worker 检查完之后归还名额的主机，由调度 goroutine 处理
+	queued   int
+	sweepAt  int // hosts 达到这个数量时清理空闲的主机
+	wake     chan struct{}
+}
+
+func newHostScheduler(defaults HostLimit) *hostScheduler {
+	return &hostScheduler{defaults: defaults, hosts: make(map[string]*hostState), sweepAt: 1024, wake: make(chan struct{}, 1)}
+}
+
+// hostKey 返回目标所属的主机，不带端口：限速是为了不压垮对方的机器，同一台机器上的所有服务共用一个限制。
+// 熔断按 host:port 区分，见 breakerKey。URL 无效时返回空字符串（不限制）
+func hostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// run 从 targets 读取目标并编号，按主机的限制发到 out，targets 关闭并且所有目标都发出去之后关闭 out
+func (s *hostScheduler) run(ctx context.Context, targets <-chan Target, out chan<- job) {
+	defer close(out)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	seq := 0
+	in, done := targets, ctx.Done()
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		for _, h := range s.released {
+			s.update(h, now)
+		}
+		s.released = s.released[:0]
+		for len(s.timers) > 0 && !s.timers[0].at.After(now) {
+			h := heap.Pop(&s.timers).(timerEntry).host
+			h.waiting = false
+			s.update(h, now)
+		}
+		if in == nil && s.queued == 0 {
+			s.mu.Unlock()
+			return
+		}
+
+		// 每次循环最多发出一个目标：select 中的发送分支只能准备一个值
+		var send chan<- job
+		var next job
+		if len(s.ready) > 0 {
+			send, next = out, s.ready[0].queue[0]
+		}
+		recv := in
+		if s.queued >= maxQueued {
+			recv = nil
+		}
+		var timerC <-chan time.Time
+		if len(s.timers) > 0 {
+			// 知识点：从 Go 1.23 开始 Reset 会丢掉还没读出的旧值，不需要先 Stop 再清空 channel
+			timer.Reset(s.timers[0].at.Sub(now))
+			timerC = timer.C
+		}
+		s.mu.Unlock()
+
+		select {
+		case t, ok := <-recv:
+			if !ok {
+				in = nil
+				break
+			}
+			s.enqueue(job{seq: seq, target: t})
+			seq++
+		case send <- next:
+			s.dispatched()
+		case <-s.wake:
+		case <-timerC:
+		case <-done:
+			done = nil
+			s.mu.Lock()
+			s.canceled = true
+			for _, h := range s.hosts {
+				h.limit = HostLimit{}
+				s.update(h, time.Now())
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// enqueue 把目标放到它的主机的队列中
+func (s *hostScheduler) enqueue(j job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	limit := s.defaults
+	if j.target.HostLimit != nil {
+		limit = *j.target.HostLimit
+	}
+	key := hostKey(j.target.URL)
+	if key == "" || !limit.limited() || s.canceled {
+		key, limit = "", HostLimit{} // 不限制的目标都放在同一个队列里，按顺序发出
+	}
+	h, ok := s.hosts[key]
+	if !ok {
+		h = &hostState{key: key, index: -1, last: time.Now(), tokens: float64(max(limit.Burst, 1))}
+		s.hosts[key] = h
+	}
+	h.limit = limit // 同一个主机的目标最好使用相同的限制，不同时以最近读到的为准
+	j.host = h
+	h.queue = append(h.queue, j)
+	s.queued++
+	s.update(h, time.Now())
+	if len(s.hosts) >= s.sweepAt {
+		s.sweep(time.Now())
+	}
+}
+
+// dispatched 在 ready 堆顶的目标被 worker 拿走之后调用
+func (s *hostScheduler) dispatched() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.ready[0]
+	h.queue = h.queue[1:]
+	s.queued--
+	h.active++
+	if h.limit.RPS > 0 {
+		h.tokens--
+	}
+	s.update(h, time.Now())
+}
+
+// release 在 worker 检查完一个目标后调用
+func (s *hostScheduler) release(h *hostState) {
+	s.mu.Lock()
+	h.active--
+	s.released = append(s.released, h)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// update 根据主机现在的状态把它放进或移出 ready 堆，需要等令牌时放进 timers 堆。调用者持有 s.mu
+func (s *hostScheduler) update(h *hostState, now time.Time) {
+	ok, wait := false, time.Duration(0)
+	if len(h.queue) > 0 {
+		ok, wait = h.canStart(now)
+	}
+	switch {
+	case ok && h.index < 0:
+		heap.Push(&s.ready, h)
+	case ok:
+		heap.Fix(&s.ready, h.index) // 队首变了
+	case h.index >= 0:
+		heap.Remove(&s.ready, h.index)
+	}
+	if wait > 0 && !h.waiting {
+		h.waiting = true
+		heap.Push(&s.timers, timerEntry{at: now.Add(wait), host: h})
+	}
+}
+
+// sweep 删除没有排队、没有在检查、令牌桶已经满了的主机，它们的状态和新建的一样，
+// 这样几百万个不同的主机也不会一直占着内存。调用者持有 s.mu
+func (s *hostScheduler) sweep(now time.Time) {
+	for key, h := range s.hosts {
+		if len(h.queue) > 0 || h.active > 0 || h.waiting {
+			continue
+		}
+		if h.limit.RPS > 0 {
+			if h.refill(now); h.tokens < float64(max(h.limit.Burst, 1)) {
+				continue
+			}
+		}
+		delete(s.hosts, key)
+	}
+	s.sweepAt = max(2*len(s.hosts), 1024)
+}
+
+// readyHeap 按队首目标的序号排列主机
+type readyHeap []*hostState
+
+func (r readyHeap) Len() int           { return len(r) }
+func (r readyHeap) Less(i, j int) bool { return r[i].queue[0].seq < r[j].queue[0].seq }
+func (r readyHeap) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+	r[i].index, r[j].index = i, j
+}
+func (r *readyHeap) Push(x any) {
+	h := x.(*hostState)
+	h.index = len(*r)
+	*r = append(*r, h)
+}
+func (r *readyHeap) Pop() any {
+	old := *r
+	h := old[len(old)-1]
+	h.index = -1
+	*r = old[:len(old)-1]
+	return h
+}
+
+// timerHeap 按拿到下一个令牌的时间排列主机
+type timerEntry struct {
+	at   time.Time
+	host *hostState
+}
+
+type timerHeap []timerEntry
+
+func (t timerHeap) Len() int           { return len(t) }
+func (t timerHeap) Less(i, j int) bool { return t[i].at.Before(t[j].at) }
+func (t timerHeap) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t *timerHeap) Push(x any)        { *t = append(*t, x.(timerEntry)) }
+func (t *timerHeap) Pop() any {
+	old := *t
+	e := old[len(old)-1]
+	*t = old[:len(old)-1]
+	return e
+}
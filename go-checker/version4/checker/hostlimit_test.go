@@ -0,0 +1,117 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimitRate(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		starts []time.Time // 受限主机收到请求的时间
+	)
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		starts = append(starts, time.Now())
+	}))
+	defer limited.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	// 127.0.0.1 和 localhost 是两个主机，只有前者限速，两者的目标交替排列
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	limit := &HostLimit{RPS: 20}
+	var targets []Target
+	for range 5 {
+		targets = append(targets, Target{Name: "limited", URL: limited.URL, HostLimit: limit})
+		for range 4 {
+			targets = append(targets, Target{Name: "other", URL: otherURL})
+		}
+	}
+
+	start := time.Now()
+	var otherDone, limitedDone time.Duration
+	for res := range Run(context.Background(), targets, Options{Concurrency: 2}) {
+		if !res.OK() {
+			t.Fatalf("期望检查成功, 但得到了 %v", res.Error)
+		}
+		if res.Name == "other" {
+			otherDone = time.Since(start)
+		} else {
+			limitedDone = time.Since(start)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(starts); i++ {
+		// 每秒 20 个，间隔 50ms，留一点余量
+		if gap := starts[i].Sub(starts[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("第 %d 个请求和前一个只隔了 %v, 期望至少 50ms", i+1, gap)
+		}
+	}
+	if otherDone >= limitedDone {
+		t.Errorf("期望不限速的主机先检查完（%v）, 而不是等受限的主机（%v）", otherDone, limitedDone)
+	}
+}
+
+func TestHostLimitConcurrent(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	targets := make([]Target, 12)
+	for i := range targets {
+		targets[i] = Target{URL: server.URL}
+	}
+	n := 0
+	for range Run(context.Background(), targets, Options{Concurrency: 8, HostLimit: &HostLimit{MaxConcurrent: 2}}) {
+		n++
+	}
+	if n != len(targets) {
+		t.Fatalf("期望 %d 个结果, 但得到了 %d 个", len(targets), n)
+	}
+	if p := peak.Load(); p != 2 {
+		t.Errorf("期望同一个主机最多同时有 2 个请求, 但最多有 %d 个", p)
+	}
+}
+
+func TestHostLimitCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// 每秒只能开始 1 个检查，取消之后剩下的目标不应该再等令牌
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	targets := make([]Target, 5)
+	for i := range targets {
+		targets[i] = Target{URL: server.URL}
+	}
+	start := time.Now()
+	canceled := 0
+	for res := range Run(ctx, targets, Options{HostLimit: &HostLimit{RPS: 1}}) {
+		cancel()
+		if res.Category() == CategoryCanceled {
+			canceled++
+		}
+	}
+	if canceled != 4 {
+		t.Errorf("期望第一个之后的 4 个目标都被取消, 但得到了 %d 个", canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("期望取消之后立即返回, 但用了 %v", elapsed)
+	}
+}
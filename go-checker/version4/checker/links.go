@@ -0,0 +1,52 @@
+package checker
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// linkTagPattern 匹配可能带有链接的标签。知识点：标准库没有 HTML 解析器，
+	// 这里只需要找出几种标签的属性，用正则就够了，不必引入 golang.org/x/net/html。
+	linkTagPattern = regexp.MustCompile(`(?is)<(a|img|script|link)\b([^>]*)>`)
+	// linkAttrPattern 匹配 href 或 src 属性，值可以用双引号、单引号或者不用引号
+	linkAttrPattern = regexp.MustCompile(`(?is)\b(href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	commentPattern  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// linkAttrs 是每种标签中存放链接的属性
+	linkAttrs = map[string]string{"a": "href", "link": "href", "img": "src", "script": "src"}
+)
+
+// extractLinks 找出 HTML 中 <a href>、<img src>、<script src>、<link href> 的链接，
+// 按 base 转换成绝对地址，去掉 #fragment 并去重。只保留 http 和 https 链接。
+func extractLinks(body []byte, base *url.URL) []string {
+	doc := commentPattern.ReplaceAll(body, nil)
+	seen := make(map[string]bool)
+	var links []string
+	for _, tag := range linkTagPattern.FindAllSubmatch(doc, -1) {
+		name := strings.ToLower(string(tag[1]))
+		for _, attr := range linkAttrPattern.FindAllSubmatch(tag[2], -1) {
+			if strings.ToLower(string(attr[1])) != linkAttrs[name] {
+				continue
+			}
+			raw := html.UnescapeString(strings.TrimSpace(string(attr[2]) + string(attr[3]) + string(attr[4])))
+			u, err := base.Parse(raw)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue // mailto:、javascript:、data: 等
+			}
+			u.Fragment = ""
+			if link := u.String(); !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	return links
+}
+
+// isHTML 判断响应是否是 HTML 页面
+func isHTML(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html")
+}
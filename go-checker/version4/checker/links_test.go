@@ -0,0 +1,40 @@
+package checker
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/index.html")
+	body := `<html><head>
+<link rel="stylesheet" HREF="/static/site.css">
+<script src='app.js'></script>
+</head><body>
+<a href="guide.html#install">安装</a>
+<a class=nav href=../about>关于</a>
+<A HREF="https://other.org/x?a=1&amp;b=2">外部</A>
+<img alt="logo" src="/img/logo.png">
+<a href="guide.html">重复</a>
+<a href="mailto:me@example.com">邮件</a>
+<a href="javascript:void(0)">脚本</a>
+<a href="#top">页内</a>
+<!-- <a href="/commented-out">注释</a> -->
+<img href="/not-a-link.png">
+</body></html>`
+
+	got := extractLinks([]byte(body), base)
+	want := []string{
+		"https://example.com/static/site.css",
+		"https://example.com/docs/app.js",
+		"https://example.com/docs/guide.html",
+		"https://example.com/about",
+		"https://other.org/x?a=1&b=2",
+		"https://example.com/img/logo.png",
+		"https://example.com/docs/index.html",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("期望链接 %v, 但得到了 %v", want, got)
+	}
+}
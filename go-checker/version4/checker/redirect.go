@@ -0,0 +1,62 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxRedirects 是默认最多跟随的重定向次数，和 http.Client 的默认值一致
+const DefaultMaxRedirects = 10
+
+// ErrTooManyRedirects 表示重定向次数超过了 RedirectPolicy 的限制
+var ErrTooManyRedirects = errors.New("重定向次数过多")
+
+// RedirectPolicy 决定 HTTP 检查如何处理 3xx 重定向，为 nil 时最多跟随 DefaultMaxRedirects 次
+type RedirectPolicy struct {
+	Follow  bool // 为 false 时不跟随，直接把 3xx 响应作为结果
+	MaxHops int  // 最多跟随的次数
+}
+
+// checkRedirect 实现 http.Client 的 CheckRedirect 回调，via 是已经发出的请求
+func (p *RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	follow, max := true, DefaultMaxRedirects
+	if p != nil {
+		follow, max = p.Follow, p.MaxHops
+	}
+	if !follow {
+		// 知识点：返回 http.ErrUseLastResponse 时，Client 不再跟随，并且把这次的 3xx 响应直接返回
+		return http.ErrUseLastResponse
+	}
+	if len(via) > max {
+		return fmt.Errorf("%w: 超过了最多 %d 次的限制", ErrTooManyRedirects, max)
+	}
+	return nil
+}
+
+// Hop 是重定向链中的一次请求
+type Hop struct {
+	URL        string
+	StatusCode int // 请求失败时为 0
+	Latency    time.Duration
+}
+
+// hopRecorder 包装 http.RoundTripper，记录 Client 发出的每一次请求。
+// 知识点：Client 跟随重定向时每一跳都会调用一次 Transport 的 RoundTrip，
+// 所以在这里就能拿到完整的重定向链，而不只是最后一个响应。
+type hopRecorder struct {
+	next http.RoundTripper
+	hops []Hop
+}
+
+func (h *hopRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := h.next.RoundTrip(req)
+	hop := Hop{URL: req.URL.String(), Latency: time.Since(start)}
+	if err == nil {
+		hop.StatusCode = resp.StatusCode
+	}
+	h.hops = append(h.hops, hop)
+	return resp, err
+}
@@ -0,0 +1,70 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newRedirectServer 返回一个 /old → /mid → /new 两次重定向的服务器
+func newRedirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/mid", http.StatusMovedPermanently))
+	mux.Handle("/mid", http.RedirectHandler("/new", http.StatusFound))
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRedirectChain(t *testing.T) {
+	server := newRedirectServer(t)
+
+	res := CheckURL(context.Background(), server.URL+"/old")
+	if !res.OK() || res.StatusCode != 200 {
+		t.Fatalf("期望跟随重定向后成功, 但得到了 %d %v", res.StatusCode, res.Error)
+	}
+	want := []struct {
+		path   string
+		status int
+	}{{"/old", 301}, {"/mid", 302}, {"/new", 200}}
+	if len(res.Hops) != len(want) {
+		t.Fatalf("期望 %d 跳, 但得到了 %v", len(want), res.Hops)
+	}
+	for i, w := range want {
+		if res.Hops[i].URL != server.URL+w.path || res.Hops[i].StatusCode != w.status {
+			t.Errorf("第 %d 跳: 期望 %s (%d), 但得到了 %+v", i+1, w.path, w.status, res.Hops[i])
+		}
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	server := newRedirectServer(t)
+
+	// 不跟随时 3xx 响应就是结果，默认的状态码断言 200-399 会通过
+	res := Check(context.Background(), Target{URL: server.URL + "/old", Redirect: &RedirectPolicy{Follow: false}})
+	if !res.OK() || res.StatusCode != 301 || len(res.Hops) != 1 {
+		t.Errorf("期望不跟随重定向, 但得到了 %d %v", res.StatusCode, res.Hops)
+	}
+
+	res = Check(context.Background(), Target{URL: server.URL + "/old", Redirect: &RedirectPolicy{Follow: true, MaxHops: 1}})
+	if res.Category() != CategoryRedirect || len(res.Hops) != 2 {
+		t.Errorf("期望重定向次数超过限制, 但得到了 %v %v", res.Error, res.Hops)
+	}
+}
+
+func TestFinalURLAssertion(t *testing.T) {
+	server := newRedirectServer(t)
+
+	res := Check(context.Background(), Target{URL: server.URL + "/old", Expect: &Assertions{FinalURL: server.URL + "/new"}})
+	if !res.OK() {
+		t.Errorf("期望最终 URL 断言通过, 但得到了 %v", res.Failures)
+	}
+	res = Check(context.Background(), Target{URL: server.URL + "/old", Expect: &Assertions{FinalURL: "https://example.com/"}})
+	if len(res.Failures) != 1 || !strings.Contains(res.Failures[0], "最终 URL") {
+		t.Errorf("期望最终 URL 断言失败, 但得到了 %v", res.Failures)
+	}
+}
@@ -0,0 +1,105 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Result 是一次检查的结果，所有 Checker 都返回这个结构
+type Result struct {
+	Seq        int // 目标是 Run 或 RunStream 读到的第几个，从 0 开始，用来按输入顺序输出结果
+	URL        string
+	Name       string
+	Tags       []string
+	Kind       string // 检查类型: http, tcp, dns, tls
+	StatusCode int    // 只有 HTTP 检查才有状态码
+	Latency    time.Duration
+	Detail     string       // 附加信息，如 TCP 的对端地址、DNS 解析结果、TLS 版本
+	Timing     *PhaseTiming // HTTP 请求各阶段的耗时，其他检查为 nil
+	Hops       []Hop        // HTTP 请求经过的每一跳，最后一个是最终的响应，没有重定向时只有一个
+	Cert       *CertInfo    // https 和 tls 检查的证书信息，其他检查为 nil
+	Failures   []string     // 未通过的断言及原因
+	Warnings   []string     // 检查成功但需要注意的问题，如证书即将过期
+	FoundOn    string       // 爬取模式下发现这个链接的页面
+	Links      []string     // 爬取模式下页面中的链接
+	Error      error
+	// Attempts 是一共尝试的次数，AttemptErrors 按顺序记录每次失败尝试的原因
+	Attempts      int
+	AttemptErrors []error
+}
+
+// OK 判断检查是否成功：没有出错，并且所有断言都通过
+func (r Result) OK() bool {
+	return r.Error == nil && len(r.Failures) == 0
+}
+
+// Warn 判断检查是否成功但带有警告
+func (r Result) Warn() bool {
+	return r.OK() && len(r.Warnings) > 0
+}
+
+// 错误分类，方便 CI 等下游程序按类别统计，而不用去解析错误文本
+const (
+	CategoryAssertion     = "assertion"          // 请求成功，但断言没有通过
+	CategoryTimeout       = "timeout"            // 超时
+	CategoryDNS           = "dns"                // 域名解析失败
+	CategoryRefused       = "connection_refused" // 端口没有监听
+	CategoryTLS           = "tls"                // 证书或握手错误
+	CategoryNetwork       = "network"            // 其他网络错误
+	CategoryInvalidTarget = "invalid_target"     // URL 写错或协议不支持
+	CategoryCanceled      = "canceled"           // ctx 被取消，检查没有完成
+	CategoryRedirect      = "redirect"           // 重定向次数超过了限制
+	CategorySkipped       = "skipped"            // 主机的熔断器断开，没有检查
+	CategoryOther         = "other"
+)
+
+// Category 给失败的结果归类，成功的结果返回空字符串。
+// 知识点：errors.As / errors.Is 会沿着错误链逐层展开，即使错误被 url.Error 等包了好几层也能识别。
+func (r Result) Category() string {
+	if r.OK() {
+		return ""
+	}
+	err := r.Error
+	if err == nil {
+		return CategoryAssertion
+	}
+
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	var recordErr tls.RecordHeaderError
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, ErrUnsupportedScheme), errors.Is(err, ErrInvalidTarget):
+		return CategoryInvalidTarget
+	case errors.Is(err, ErrCanceled), errors.Is(err, context.Canceled):
+		return CategoryCanceled
+	case errors.Is(err, ErrHostDown):
+		return CategorySkipped
+	case errors.Is(err, ErrTooManyRedirects):
+		return CategoryRedirect
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return CategoryTimeout
+		}
+		return CategoryDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return CategoryTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return CategoryRefused
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr),
+		errors.As(err, &certInvalidErr), errors.As(err, &recordErr):
+		return CategoryTLS
+	case errors.As(err, &opErr):
+		return CategoryNetwork
+	}
+	return CategoryOther
+}
@@ -0,0 +1,28 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestCategory(t *testing.T) {
+	tests := []struct {
+		res  Result
+		want string
+	}{
+		{Result{StatusCode: 200}, ""},
+		{Result{Failures: []string{"x"}}, CategoryAssertion},
+		{CheckURL(context.Background(), "ftp://a.com"), CategoryInvalidTarget},
+		{CheckURL(context.Background(), "tcp://127.0.0.1:1"), CategoryRefused},
+		{Result{Error: &net.DNSError{Err: "no such host", Name: "a.invalid", IsNotFound: true}}, CategoryDNS},
+		{Result{Error: context.DeadlineExceeded}, CategoryTimeout},
+		{Result{Error: errors.New("boom")}, CategoryOther},
+	}
+	for _, tt := range tests {
+		if got := tt.res.Category(); got != tt.want {
+			t.Errorf("%v: 期望类别 %q, 但得到了 %q", tt.res.Error, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RetryPolicy 描述失败后如何重试。
+// 延迟按指数增长：BaseDelay, 2*BaseDelay, 4*BaseDelay ... 最多到 MaxDelay，
+// 再加上随机抖动，避免大量目标在同一时刻一起重试。
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试的次数（包括第一次），小于等于 1 表示不重试
+	BaseDelay   time.Duration // 第一次重试前的等待时间
+	MaxDelay    time.Duration // 等待时间的上限
+	Jitter      float64       // 抖动比例，0.2 表示在计算出的延迟上随机增减 20%
+	RetryOn     []string      // 可以重试的错误类别，见 Result.Category
+	RetryStatus []StatusRange // 可以重试的状态码，如 429、502-504
+}
+
+// DefaultRetryOn 是默认可以重试的错误类别：这些错误往往是暂时的。
+// DNS 解析失败、证书错误、断言失败等重试也多半没用，所以不在其中。
+var DefaultRetryOn = []string{CategoryTimeout, CategoryRefused, CategoryNetwork}
+
+// ParseRetryOn 解析逗号分隔的错误类别
+func ParseRetryOn(s string) ([]string, error) {
+	valid := []string{CategoryTimeout, CategoryDNS, CategoryRefused, CategoryTLS, CategoryNetwork, CategoryOther}
+	var on []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !slices.Contains(valid, c) {
+			return nil, fmt.Errorf("无效的错误类别 %q，可选 %s", c, strings.Join(valid, "、"))
+		}
+		on = append(on, c)
+	}
+	return on, nil
+}
+
+// retryable 判断一次失败的结果是否值得重试
+func (p *RetryPolicy) retryable(res Result) bool {
+	if res.OK() {
+		return false
+	}
+	if res.Error != nil {
+		return slices.Contains(p.RetryOn, res.Category())
+	}
+	// 断言失败时，只有状态码属于可重试的范围才重试
+	return res.StatusCode != 0 && statusMatches(p.RetryStatus, res.StatusCode)
+}
+
+// delay 计算第 attempt 次重试前要等待的时间，attempt 从 1 开始
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// run 执行 check，失败并且可以重试时按照退避策略再次执行，
+// 返回最后一次的结果，并记录尝试次数和每次失败的原因。ctx 被取消后不再重试。
+func (p *RetryPolicy) run(ctx context.Context, check func() Result) Result {
+	var attemptErrors []error
+	for attempt := 1; ; attempt++ {
+		res := check()
+		res.Attempts = attempt
+		if !res.OK() {
+			attemptErrors = append(attemptErrors, attemptError(res))
+		}
+		res.AttemptErrors = attemptErrors
+		if p == nil || attempt >= p.MaxAttempts || !p.retryable(res) {
+			return res
+		}
+		// 知识点：用 select 同时等待定时器和 ctx，等待期间按下 Ctrl-C 也能立即返回
+		timer := time.NewTimer(p.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return res
+		}
+	}
+}
+
+// attemptError 把一次失败的尝试转换成 error，断言失败也转换成 error 以便统一记录
+func attemptError(res Result) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	return errors.New(strings.Join(res.Failures, "; "))
+}
+
+// retried 判断这个结果是否经过了重试
+func (r Result) Retried() bool {
+	return r.Attempts > 1
+}
@@ -0,0 +1,89 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy 返回一个等待时间很短的重试策略，避免拖慢测试
+func testRetryPolicy(attempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+		RetryOn:     DefaultRetryOn,
+		RetryStatus: []StatusRange{{502, 504}},
+	}
+}
+
+func TestRetryPassesOnRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次返回 503，第三次才成功
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	res := Check(context.Background(), Target{URL: server.URL, Retry: testRetryPolicy(5)})
+	if !res.OK() {
+		t.Fatalf("期望重试后成功, 但得到了 %v %v", res.Error, res.Failures)
+	}
+	if res.Attempts != 3 || len(res.AttemptErrors) != 2 {
+		t.Errorf("期望尝试 3 次并记录 2 次失败, 但得到了 %d 次和 %v", res.Attempts, res.AttemptErrors)
+	}
+	if !res.Retried() {
+		t.Error("期望结果标记为经过了重试")
+	}
+}
+
+func TestRetryFailsAfterRetries(t *testing.T) {
+	res := Check(context.Background(), Target{URL: "tcp://127.0.0.1:1", Retry: testRetryPolicy(3)})
+	if res.OK() {
+		t.Fatal("期望连接被拒绝")
+	}
+	if res.Attempts != 3 || len(res.AttemptErrors) != 3 {
+		t.Errorf("期望尝试 3 次并记录 3 次失败, 但得到了 %d 次和 %d 个错误", res.Attempts, len(res.AttemptErrors))
+	}
+}
+
+func TestRetrySkipsNonRetryable(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// 404 不在可重试的状态码范围内，不应该重试
+	res := Check(context.Background(), Target{URL: server.URL, Retry: testRetryPolicy(3)})
+	if res.Attempts != 1 || calls.Load() != 1 {
+		t.Errorf("期望只请求 1 次, 但请求了 %d 次", calls.Load())
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := p.delay(i + 1); got != w {
+			t.Errorf("第 %d 次重试: 期望等待 %v, 但得到了 %v", i+1, w, got)
+		}
+	}
+	// 即使重试次数很多也不能溢出
+	if got := p.delay(100); got != time.Second {
+		t.Errorf("期望等待时间被限制在 1s, 但得到了 %v", got)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.delay(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("抖动后的等待时间超出范围: %v", d)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package checker
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultConcurrency 是 Options.Concurrency 为 0 时 worker 的数量
+const DefaultConcurrency = 10
+
+// Options 是 Run 和 RunStream 的参数，零值就可以直接使用
+type Options struct {
+	Concurrency int             // worker 的数量，为 0 时使用 DefaultConcurrency；设置了 Adaptive 时是初始的并发数
+	Client      *http.Client    // HTTP 检查使用的客户端，为 nil 时使用包内共享的 Transport
+	Adaptive    *AdaptivePolicy // 不为 nil 时并发数在 Min 和 Max 之间自动调整
+	HostLimit   *HostLimit      // 对每个主机的默认限制，目标自己设置了 HostLimit 时以目标的为准，为 nil 时不限制
+	Breaker     *BreakerPolicy  // 不为 nil 时按主机熔断，连不上的主机剩下的目标直接跳过
+
+	// OnStart 在 worker 开始检查一个目标之前调用，ctx 已经被取消时不再调用。
+	// OnResult 在每个结果发送到 channel 之前调用。
+	// 两个钩子都在 worker 自己的 goroutine 中并发执行，需要自己处理同步。
+	OnStart  func(worker int, t Target)
+	OnResult func(res Result)
+}
+
+// checkers 返回这次运行使用的 Checker，设置了 Client 时 HTTP 检查使用它
+func (o Options) checkers() registry {
+	if o.Client == nil {
+		return defaultCheckers
+	}
+	r := maps.Clone(defaultCheckers)
+	r["http"] = HTTPChecker{Client: o.Client}
+	r["https"] = HTTPChecker{Client: o.Client}
+	return r
+}
+
+// hostLimit 返回对每个主机的默认限制
+func (o Options) hostLimit() HostLimit {
+	if o.HostLimit == nil {
+		return HostLimit{}
+	}
+	return *o.HostLimit
+}
+
+// Check 按照 opts 的设置检查一个目标，适合不需要 worker 池、自己控制并发的调用者
+func (o Options) Check(ctx context.Context, t Target) Result {
+	return o.checkers().check(ctx, t)
+}
+
+// Run 用一个 worker 池检查所有目标，结果按完成的顺序从返回的 channel 中读出，
+// 所有目标都检查完之后 channel 被关闭。
+// ctx 被取消后，剩下的目标不再检查，直接返回被取消的结果，所以结果的数量总是和目标一样多。
+// 调用者必须把 channel 读完，否则 worker 会一直阻塞。
+func Run(ctx context.Context, targets []Target, opts Options) <-chan Result {
+	jobs := make(chan Target)
+	go func() {
+		defer close(jobs)
+		for _, t := range targets {
+			jobs <- t
+		}
+	}()
+	return RunStream(ctx, jobs, opts)
+}
+
+// RunStream 和 Run 一样，但目标从 targets 中读取，适合边检查边产生目标的场景，如爬取和监控。
+// 调用者关闭 targets、并且已经发出的目标都检查完之后，返回的 channel 被关闭。
+// ctx 被取消之后发送的目标不会被检查，直接返回被取消的结果。
+// 每个结果的 Seq 是对应的目标从 targets 中读出的顺序。
+func RunStream(ctx context.Context, targets <-chan Target, opts Options) <-chan Result {
+	n := opts.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	checkers := opts.checkers()
+	results := make(chan Result)
+
+	// 自适应模式下启动 Max 个 worker，由 limiter 控制同时有几个在检查
+	var lim *limiter
+	done := make(chan struct{})
+	if opts.Adaptive != nil {
+		policy := opts.Adaptive.withDefaults()
+		lim = newLimiter(min(max(n, policy.Min), policy.Max))
+		n = policy.Max
+		go lim.control(policy, done)
+	}
+
+	// 由调度器统一读取 targets 并编号（worker 各自读取的话没法知道谁先谁后），再按主机的限制发给 worker
+	sched := newHostScheduler(opts.hostLimit())
+	jobs := make(chan job)
+	go sched.run(ctx, targets, jobs)
+
+	p := &pool{checkers: checkers, lim: lim, sched: sched, breakers: newBreakerSet(opts.Breaker), results: results, opts: opts}
+	var wg sync.WaitGroup
+	for id := 1; id <= n; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.worker(ctx, id, jobs)
+		}()
+	}
+	// 所有 worker 退出之后才能关闭 results，否则 worker 可能向已关闭的 channel 发送而 panic
+	go func() {
+		wg.Wait()
+		close(done)
+		close(results)
+	}()
+	return results
+}
+
+// job 是带有序号的目标
+type job struct {
+	seq    int
+	target Target
+	host   *hostState // 调度器中目标所属的主机，检查完之后归还名额
+}
+
+// pool 是 worker 共用的东西
+type pool struct {
+	checkers registry
+	lim      *limiter // 自适应模式下控制并发数，否则为 nil
+	sched    *hostScheduler
+	breakers *breakerSet // 没有设置 Options.Breaker 时为 nil
+	results  chan<- Result
+	opts     Options
+}
+
+// worker 从 jobs 接收目标，检查之后把结果发送到 results。
+// 自适应模式下，每次接收目标之前先从 lim 拿到名额，检查完归还
+func (p *pool) worker(ctx context.Context, id int, jobs <-chan job) {
+	for {
+		if p.lim != nil {
+			p.lim.acquire()
+		}
+		j, ok := <-jobs
+		if !ok {
+			if p.lim != nil {
+				p.lim.release(nil)
+			}
+			return
+		}
+		if p.lim != nil {
+			p.lim.start()
+		}
+		res := p.check(ctx, id, j.target)
+		res.Seq = j.seq
+		p.sched.release(j.host)
+		if p.lim != nil {
+			p.lim.release(&res)
+		}
+		if p.opts.OnResult != nil {
+			p.opts.OnResult(res)
+		}
+		p.results <- res
+	}
+}
+
+// check 检查一个目标，主机的熔断器断开时直接返回跳过的结果
+func (p *pool) check(ctx context.Context, id int, t Target) Result {
+	if ctx.Err() != nil {
+		return p.checkers.check(ctx, t) // 被取消之后直接返回被取消的结果，不再经过熔断器
+	}
+	probe, skipped := p.breakers.allow(t, time.Now())
+	if skipped != nil {
+		return *skipped
+	}
+	if p.opts.OnStart != nil && ctx.Err() == nil {
+		p.opts.OnStart(id, t)
+	}
+	res := p.checkers.check(ctx, t)
+	p.breakers.record(t, res, probe, time.Now())
+	return res
+}
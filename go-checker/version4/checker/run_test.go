@@ -0,0 +1,128 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	targets := []Target{
+		{Name: "a", URL: server.URL + "/a"},
+		{Name: "b", URL: server.URL + "/b"},
+		{Name: "bad", URL: server.URL + "/bad"},
+		{Name: "invalid", URL: "ftp://example.com"},
+	}
+	var (
+		mu      sync.Mutex
+		started []string
+		workers = make(map[int]bool)
+		hooked  atomic.Int32
+	)
+	opts := Options{
+		Concurrency: 2,
+		OnStart: func(worker int, t Target) {
+			mu.Lock()
+			defer mu.Unlock()
+			started = append(started, t.Name)
+			workers[worker] = true
+		},
+		OnResult: func(Result) { hooked.Add(1) },
+	}
+
+	got := make(map[string]Result)
+	for res := range Run(context.Background(), targets, opts) {
+		got[res.Name] = res
+	}
+	if len(got) != len(targets) || hooked.Load() != int32(len(targets)) {
+		t.Fatalf("期望 %d 个结果, 但得到了 %d 个, OnResult 调用了 %d 次", len(targets), len(got), hooked.Load())
+	}
+	if !got["a"].OK() || !got["b"].OK() || got["bad"].OK() || got["invalid"].Category() != CategoryInvalidTarget {
+		t.Errorf("检查结果错误: %+v", got)
+	}
+	slices.Sort(started)
+	if !slices.Equal(started, []string{"a", "b", "bad", "invalid"}) {
+		t.Errorf("期望每个目标调用一次 OnStart, 但得到了 %v", started)
+	}
+	for w := range workers {
+		if w < 1 || w > 2 {
+			t.Errorf("worker 编号 %d 超出了 1~2 的范围", w)
+		}
+	}
+}
+
+// countingTransport 记录经过它的请求数
+type countingTransport struct {
+	n atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.n.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRunClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	targets := []Target{{URL: server.URL}, {URL: server.URL}, {URL: server.URL}}
+	for res := range Run(context.Background(), targets, Options{Client: &http.Client{Transport: transport}}) {
+		if !res.OK() {
+			t.Errorf("期望检查成功, 但得到了 %v", res.Error)
+		}
+	}
+	if n := transport.n.Load(); n != 3 {
+		t.Errorf("期望 HTTP 检查使用传入的 Client, 但它只收到了 %d 个请求", n)
+	}
+}
+
+func TestRunStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	jobs := make(chan Target)
+	results := RunStream(context.Background(), jobs, Options{Concurrency: 3})
+
+	// 边发送边读取：每拿到一个结果再发下一个目标
+	for i := range 5 {
+		jobs <- Target{URL: server.URL, Name: string(rune('a' + i))}
+		if res := <-results; !res.OK() {
+			t.Errorf("期望检查成功, 但得到了 %v", res.Error)
+		}
+	}
+	close(jobs)
+	if _, ok := <-results; ok {
+		t.Error("期望关闭 targets 之后结果 channel 也被关闭")
+	}
+}
+
+func TestRunSeq(t *testing.T) {
+	var targets []Target
+	for i := range 20 {
+		// 无效的目标不会发出请求，检查得很快，完成的顺序取决于调度
+		targets = append(targets, Target{Name: strconv.Itoa(i), URL: "ftp://example.com"})
+	}
+	seen := make(map[int]bool)
+	for res := range Run(context.Background(), targets, Options{Concurrency: 4}) {
+		if res.Name != strconv.Itoa(res.Seq) {
+			t.Errorf("期望结果的 Seq 和目标在输入中的位置一致, 但 %s 的 Seq 是 %d", res.Name, res.Seq)
+		}
+		seen[res.Seq] = true
+	}
+	if len(seen) != len(targets) {
+		t.Errorf("期望 Seq 不重复, 但只有 %d 个不同的值", len(seen))
+	}
+}
@@ -0,0 +1,91 @@
+package checker
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// PhaseTiming 是一次 HTTP 请求各个阶段的耗时，用来判断慢在哪里。
+// 连接被复用时 DNS、Connect、TLS 都为 0；发生重定向时前三项是所有请求的总和。
+type PhaseTiming struct {
+	DNS      time.Duration // DNS 解析
+	Connect  time.Duration // 建立 TCP 连接
+	TLS      time.Duration // TLS 握手
+	TTFB     time.Duration // 请求发送完到收到响应第一个字节，基本就是服务器的处理时间
+	Download time.Duration // 从收到响应的第一个字节到读完响应体
+}
+
+// phaseTracer 通过 httptrace 的回调记录各阶段的开始和结束时间。
+// 知识点：httptrace.ClientTrace 是一组钩子函数，net/http 在请求的各个阶段调用它们。
+// 这些回调可能在别的 goroutine 中被调用（比如同时尝试 IPv4 和 IPv6 连接），所以要加锁。
+type phaseTracer struct {
+	mu                                      sync.Mutex
+	timing                                  PhaseTiming
+	dnsStart, connectStart, tlsStart, wrote time.Time
+	firstByte                               time.Time // 最后一次请求收到第一个字节的时间，下载阶段从这里算起
+}
+
+func (p *phaseTracer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { p.mark(&p.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { p.since(&p.timing.DNS, &p.dnsStart) },
+		ConnectStart: func(string, string) {
+			p.mark(&p.connectStart)
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil { // 失败的连接尝试不计入
+				p.since(&p.timing.Connect, &p.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { p.mark(&p.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.since(&p.timing.TLS, &p.tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { p.mark(&p.wrote) },
+		GotFirstResponseByte: func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.firstByte = time.Now()
+			p.timing.TTFB = p.firstByte.Sub(p.wrote) // 重定向时只保留最后一次请求的
+		},
+	}
+}
+
+// mark 记录某个阶段的开始时间
+func (p *phaseTracer) mark(t *time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*t = time.Now()
+}
+
+// since 把从 *start 到现在的耗时累加到 d 上
+func (p *phaseTracer) since(d *time.Duration, start *time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !start.IsZero() {
+		*d += time.Since(*start)
+	}
+}
+
+// finish 在读完响应体时调用，返回包括下载阶段在内的耗时。
+// 下载从收到第一个字节算起：client.Do 返回之前可能已经读到了一部分响应体，从 Do 返回时算起会漏掉这部分。
+// 没有收到第一个字节的记录时（如自定义的 Transport 不支持 httptrace）从 fallback 算起
+func (p *phaseTracer) finish(fallback time.Time) PhaseTiming {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := p.firstByte
+	if start.IsZero() {
+		start = fallback
+	}
+	p.timing.Download = time.Since(start)
+	return p.timing
+}
+
+// result 返回记录到的耗时
+func (p *phaseTracer) result() PhaseTiming {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.timing
+}
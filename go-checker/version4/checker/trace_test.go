@@ -0,0 +1,40 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPPhaseTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond) // 模拟服务器处理时间
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		time.Sleep(30 * time.Millisecond) // 模拟响应体传输很慢
+		w.Write([]byte(" world"))
+	}))
+	defer server.Close()
+
+	res := CheckURL(context.Background(), server.URL)
+	if !res.OK() || res.Timing == nil {
+		t.Fatalf("期望检查成功并记录各阶段耗时, 但得到了 %+v", res)
+	}
+	tm := res.Timing
+	if tm.TTFB < 50*time.Millisecond {
+		t.Errorf("期望 TTFB 至少 50ms, 但得到了 %v", tm.TTFB)
+	}
+	// 响应体中间停了 30ms，下载应该明显比建立连接这样的快速阶段慢，留一些余量避免计时误差
+	if tm.Download < 20*time.Millisecond || tm.Download < 2*tm.Connect {
+		t.Errorf("期望下载耗时明显大于建立连接的 %v, 但得到了 %v", tm.Connect, tm.Download)
+	}
+	if tm.Connect <= 0 {
+		t.Errorf("期望记录到建立连接的耗时, 但得到了 %v", tm.Connect)
+	}
+	// 127.0.0.1 不需要 DNS 解析，明文 HTTP 也没有 TLS 握手
+	if tm.DNS != 0 || tm.TLS != 0 {
+		t.Errorf("期望 DNS 和 TLS 耗时为 0, 但得到了 %v 和 %v", tm.DNS, tm.TLS)
+	}
+}
@@ -0,0 +1,90 @@
+package checker
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 连接池的默认大小
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = DefaultConcurrency // 和 worker 数量一样，检查同一个主机的 worker 都能复用连接
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// TransportOptions 是 NewTransport 的参数，零值就可以直接使用
+type TransportOptions struct {
+	MaxIdleConns        int           // 所有主机合计保留的空闲连接数，为 0 时使用 DefaultMaxIdleConns
+	MaxIdleConnsPerHost int           // 每个主机保留的空闲连接数，为 0 时使用 DefaultMaxIdleConnsPerHost
+	MaxConnsPerHost     int           // 每个主机同时打开的连接上限（包括正在使用的），为 0 时不限制
+	IdleConnTimeout     time.Duration // 空闲连接保留多久，为 0 时使用 DefaultIdleConnTimeout
+	DisableHTTP2        bool          // 只使用 HTTP/1.1
+}
+
+// NewTransport 创建一个适合批量检查的 http.Transport。
+// 知识点：连接池在 Transport 里，而不是在 http.Client 里。
+// http.DefaultTransport 每个主机只保留 2 个空闲连接，
+// 10 个 worker 同时检查同一个站点时，多出来的连接用完就被关掉，下次又要重新握手。
+// 所以应该创建一个 Transport 并在所有检查之间共享，Client 可以随用随建。
+func NewTransport(o TransportOptions) *http.Transport {
+	if o.MaxIdleConns <= 0 {
+		o.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost <= 0 {
+		o.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second, // 实际的超时由每个目标的 Timeout 通过 ctx 控制
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     !o.DisableHTTP2,
+		MaxIdleConns:          o.MaxIdleConns,
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       o.MaxConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if o.DisableHTTP2 {
+		// 知识点：TLSNextProto 是一个非 nil 的空 map 时，Transport 不会启用 HTTP/2
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return t
+}
+
+// sharedTransport 是 Options.Client 为 nil 时所有 HTTP 检查共用的 Transport
+var sharedTransport = NewTransport(TransportOptions{})
+
+// insecureTransports 缓存每个 Transport 跳过证书校验的版本，
+// 这样 insecure 目标之间也能复用连接，而不是每次检查都新建一个 Transport
+var insecureTransports sync.Map // *http.Transport -> *http.Transport
+
+// insecureTransport 返回 base 的一个跳过证书校验的副本，同一个 base 总是返回同一个副本
+func insecureTransport(base *http.Transport) *http.Transport {
+	if t, ok := insecureTransports.Load(base); ok {
+		return t.(*http.Transport)
+	}
+	t := base.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.InsecureSkipVerify = true
+	actual, _ := insecureTransports.LoadOrStore(base, t)
+	return actual.(*http.Transport)
+}
+
+// freshTransport 返回 base 的一个不复用连接的副本，每次请求都重新建立连接（包括 DNS、TCP 和 TLS 握手），
+// 用于测量冷启动的延迟。调用者用完之后要调用 CloseIdleConnections。
+func freshTransport(base *http.Transport) *http.Transport {
+	t := base.Clone()
+	t.DisableKeepAlives = true
+	return t
+}
@@ -0,0 +1,128 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newCountingServer 启动一个测试服务器，返回的计数器记录服务器接受了多少个新连接
+func newCountingServer(t testing.TB, body string) (*httptest.Server, *atomic.Int32) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &conns
+}
+
+func TestConnectionReuse(t *testing.T) {
+	// 响应体比较大，没有读完就关闭的话连接不能复用
+	server, conns := newCountingServer(t, strings.Repeat("x", 256<<10))
+	for range 20 {
+		if res := Check(context.Background(), Target{URL: server.URL}); !res.OK() {
+			t.Fatalf("期望检查成功, 但得到了 %v", res.Error)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("期望 20 次检查复用同一个连接, 但服务器接受了 %d 个连接", n)
+	}
+}
+
+func TestFreshConn(t *testing.T) {
+	server, conns := newCountingServer(t, "ok")
+	for range 5 {
+		if res := Check(context.Background(), Target{URL: server.URL, FreshConn: true}); !res.OK() {
+			t.Fatalf("期望检查成功, 但得到了 %v", res.Error)
+		}
+	}
+	if n := conns.Load(); n != 5 {
+		t.Errorf("期望 FreshConn 每次检查都建立新连接, 但服务器接受了 %d 个连接", n)
+	}
+}
+
+func TestInsecureConnectionReuse(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	for range 5 {
+		if res := Check(context.Background(), Target{URL: server.URL, Insecure: true}); !res.OK() {
+			t.Fatalf("期望检查成功, 但得到了 %v", res.Error)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("期望 insecure 目标之间也复用连接, 但服务器接受了 %d 个连接", n)
+	}
+}
+
+func TestTransportHTTP2(t *testing.T) {
+	var proto atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto.Store(int32(r.ProtoMajor))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tc := range []struct {
+		disable bool
+		want    int32
+	}{{false, 2}, {true, 1}} {
+		client := &http.Client{Transport: NewTransport(TransportOptions{DisableHTTP2: tc.disable})}
+		res := Options{Client: client}.Check(context.Background(), Target{URL: server.URL, Insecure: true})
+		if !res.OK() {
+			t.Fatalf("期望检查成功, 但得到了 %v", res.Error)
+		}
+		if got := proto.Load(); got != tc.want {
+			t.Errorf("DisableHTTP2=%v: 期望使用 HTTP/%d, 但得到了 HTTP/%d", tc.disable, tc.want, got)
+		}
+	}
+}
+
+// BenchmarkHTTPCheck 比较复用连接和每次新建连接的开销，conns/op 是平均每次检查新建的连接数。
+// 运行: go test -bench HTTPCheck -benchmem ./go-checker/version4/checker
+func BenchmarkHTTPCheck(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		target Target
+		opts   Options
+	}{
+		{name: "shared", opts: Options{}},
+		{name: "fresh", target: Target{FreshConn: true}},
+		// http.DefaultTransport 每个主机只保留 2 个空闲连接，并发检查时连接会不断被关掉重建
+		{name: "default-transport", opts: Options{Client: &http.Client{Transport: http.DefaultTransport}}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			server, conns := newCountingServer(b, strings.Repeat("x", 4<<10))
+			target := bc.target
+			target.URL = server.URL
+			b.SetParallelism(4) // 每个 CPU 4 个 goroutine，模拟多个 worker 检查同一个站点
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if res := bc.opts.Check(context.Background(), target); !res.OK() {
+						b.Errorf("期望检查成功, 但得到了 %v", res.Error)
+					}
+				}
+			})
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
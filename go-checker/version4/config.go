@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// 配置文件示例（JSON 格式）：
+//
+//	{
+//	  "defaults": {"timeout": "5s", "headers": {"User-Agent": "go-checker"}},
+//	  "targets": [
+//	    {"name": "首页", "url": "https://example.com", "tags": ["web"]},
+//	    {
+//	      "name": "登录接口", "url": "https://example.com/api/login",
+//	      "method": "POST", "body": "{\"user\":\"ping\"}", "timeout": "2s", "interval": "30s",
+//	      "headers": {"Content-Type": "application/json"},
+//	      "expect": {"status": "200,401", "json": {"code": 0}},
+//	      "retry": {"attempts": 3, "base_delay": "200ms", "max_delay": "2s", "on": ["timeout"], "status": "503"}
+//	    },
+//	    {"name": "旧域名", "url": "http://old.example.com", "redirect": {"max": 3}, "expect": {"final_url": "https://example.com/"}},
+//	    {"name": "内部服务", "url": "https://10.0.0.8", "insecure": true, "cert_warn": "30d"},
+//	    {"name": "冷启动", "url": "https://example.com/health", "fresh_conn": true},
+//	    {"name": "限速接口", "url": "https://api.example.com/v1/status", "host_limit": {"rps": 2, "burst": 5, "max_concurrent": 2}},
+//	    {"name": "数据库", "url": "tcp://127.0.0.1:3306", "tags": ["db"]}
+//	  ]
+//	}
+//
+// defaults 中的设置会作为每个目标的默认值，目标自己的设置优先。
+
+// targetConfig 是配置文件中一个目标的写法
+type targetConfig struct {
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	Body      string            `json:"body"`
+	Timeout   string            `json:"timeout"`
+	Interval  string            `json:"interval"` // 监控模式下的检查间隔
+	Tags      []string          `json:"tags"`
+	Expect    *assertConfig     `json:"expect"`
+	Retry     *retryConfig      `json:"retry"`
+	Redirect  *redirectConfig   `json:"redirect"`
+	CertWarn  string            `json:"cert_warn"`  // 证书过期警告阈值，如 "14d"、"72h"，"0" 表示不检查
+	Insecure  bool              `json:"insecure"`   // 跳过证书校验
+	FreshConn bool              `json:"fresh_conn"` // 不复用连接，测量冷启动延迟
+	HostLimit *hostLimitConfig  `json:"host_limit"`
+}
+
+// assertConfig 是配置文件中断言的写法，对应 Assertions
+type assertConfig struct {
+	Status    string            `json:"status"`     // 如 "200,301-302,2xx"
+	Body      string            `json:"body"`       // 响应体必须包含的子串
+	BodyRegex string            `json:"body_regex"` // 响应体必须匹配的正则
+	Headers   map[string]string `json:"headers"`
+	JSON      map[string]any    `json:"json"`      // JSON 路径 -> 期望值
+	FinalURL  string            `json:"final_url"` // 跟随重定向之后最终的 URL
+}
+
+// build 校验并编译断言配置
+func (c *assertConfig) build() (*checker.Assertions, error) {
+	if c == nil {
+		return nil, nil
+	}
+	a := &checker.Assertions{Body: c.Body, Headers: c.Headers, JSON: c.JSON, FinalURL: c.FinalURL}
+	var err error
+	if a.Status, err = checker.ParseStatusRanges(c.Status); err != nil {
+		return nil, err
+	}
+	if c.BodyRegex != "" {
+		if a.BodyRegex, err = regexp.Compile(c.BodyRegex); err != nil {
+			return nil, fmt.Errorf("无效的正则 %q: %v", c.BodyRegex, err)
+		}
+	}
+	return a, nil
+}
+
+// retryConfig 是配置文件中重试策略的写法，对应 RetryPolicy
+type retryConfig struct {
+	Attempts  int      `json:"attempts"`   // 最多尝试的次数（包括第一次）
+	BaseDelay string   `json:"base_delay"` // 如 "200ms"
+	MaxDelay  string   `json:"max_delay"`  // 如 "5s"
+	Jitter    float64  `json:"jitter"`     // 0~1
+	On        []string `json:"on"`         // 可以重试的错误类别，默认 timeout、connection_refused、network
+	Status    *string  `json:"status"`     // 可以重试的状态码，默认 "429,502-504"，写 "" 表示不按状态码重试
+}
+
+// build 校验重试配置，没有写的字段使用默认值
+func (c *retryConfig) build() (*checker.RetryPolicy, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Attempts < 1 {
+		return nil, fmt.Errorf("重试次数 attempts 至少为 1")
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return nil, fmt.Errorf("抖动比例 jitter 应在 0~1 之间: %v", c.Jitter)
+	}
+	p := &checker.RetryPolicy{MaxAttempts: c.Attempts, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second, Jitter: c.Jitter}
+	var err error
+	if c.BaseDelay != "" {
+		if p.BaseDelay, err = time.ParseDuration(c.BaseDelay); err != nil || p.BaseDelay < 0 {
+			return nil, fmt.Errorf("无效的重试等待时间 %q", c.BaseDelay)
+		}
+	}
+	if c.MaxDelay != "" {
+		if p.MaxDelay, err = time.ParseDuration(c.MaxDelay); err != nil || p.MaxDelay < p.BaseDelay {
+			return nil, fmt.Errorf("无效的重试等待上限 %q", c.MaxDelay)
+		}
+	}
+	p.RetryOn = checker.DefaultRetryOn
+	if c.On != nil {
+		if p.RetryOn, err = checker.ParseRetryOn(strings.Join(c.On, ",")); err != nil {
+			return nil, err
+		}
+	}
+	status := "429,502-504"
+	if c.Status != nil {
+		status = *c.Status
+	}
+	if p.RetryStatus, err = checker.ParseStatusRanges(status); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// redirectConfig 是配置文件中重定向策略的写法，对应 RedirectPolicy
+type redirectConfig struct {
+	Follow *bool `json:"follow"` // 是否跟随重定向，默认跟随
+	Max    *int  `json:"max"`    // 最多跟随的次数，默认 10，和 -max-redirects 一样 0 表示不跟随
+}
+
+// build 校验重定向配置，没有写的字段使用默认值
+func (c *redirectConfig) build() (*checker.RedirectPolicy, error) {
+	if c == nil {
+		return nil, nil
+	}
+	p := &checker.RedirectPolicy{Follow: true, MaxHops: checker.DefaultMaxRedirects}
+	if c.Follow != nil {
+		p.Follow = *c.Follow
+	}
+	if c.Max != nil {
+		if *c.Max < 0 {
+			return nil, fmt.Errorf("重定向次数 max 不能为负数: %d", *c.Max)
+		}
+		if *c.Max == 0 && c.Follow != nil && *c.Follow {
+			return nil, errors.New("重定向次数 max 为 0 表示不跟随重定向，不能同时设置 follow 为 true")
+		}
+		p.MaxHops = *c.Max
+		p.Follow = p.Follow && *c.Max > 0
+	}
+	return p, nil
+}
+
+// hostLimitConfig 是配置文件中主机限制的写法，对应 HostLimit。
+// 限制是按主机计算的，同一个主机的目标应该写相同的限制
+type hostLimitConfig struct {
+	RPS           float64 `json:"rps"`            // 每秒最多开始几个检查，0 表示不限制
+	Burst         int     `json:"burst"`          // 最多可以连续开始几个检查，默认 1
+	MaxConcurrent int     `json:"max_concurrent"` // 同时最多几个检查，0 表示不限制
+}
+
+// build 校验主机限制配置
+func (c *hostLimitConfig) build() (*checker.HostLimit, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.RPS < 0 || c.Burst < 0 || c.MaxConcurrent < 0 {
+		return nil, fmt.Errorf("rps、burst 和 max_concurrent 不能为负数")
+	}
+	return &checker.HostLimit{RPS: c.RPS, Burst: c.Burst, MaxConcurrent: c.MaxConcurrent}, nil
+}
+
+var methodPattern = regexp.MustCompile(`^[A-Z]+$`)
+
+// toTarget 合并默认值并校验，生成一个可以检查的 Target
+func (c targetConfig) toTarget(defaults targetConfig) (checker.Target, error) {
+	if c.URL == "" {
+		return checker.Target{}, errors.New("缺少 url")
+	}
+	if _, err := checker.CheckerFor(c.URL); err != nil {
+		return checker.Target{}, fmt.Errorf("url %q: %v", c.URL, err)
+	}
+	t := checker.Target{Name: c.Name, URL: c.URL}
+
+	// method、headers、body 和断言只对 HTTP 检查有意义，写在其他目标上多半是配置错误
+	if !t.IsHTTP() {
+		if c.Method != "" || len(c.Headers) > 0 || c.Body != "" || c.Expect != nil || c.Redirect != nil || c.FreshConn {
+			return checker.Target{}, errors.New("method、headers、body、expect、redirect 和 fresh_conn 只能用于 http(s) 目标")
+		}
+		defaults = targetConfig{Timeout: defaults.Timeout, Interval: defaults.Interval, Tags: defaults.Tags, Retry: defaults.Retry,
+			CertWarn: defaults.CertWarn, Insecure: defaults.Insecure, HostLimit: defaults.HostLimit}
+	}
+
+	t.Method = strings.ToUpper(firstNonEmpty(c.Method, defaults.Method))
+	t.Body = firstNonEmpty(c.Body, defaults.Body)
+	t.Tags = append(append([]string(nil), defaults.Tags...), c.Tags...)
+	if len(defaults.Headers)+len(c.Headers) > 0 {
+		t.Headers = make(map[string]string)
+		for k, v := range defaults.Headers {
+			t.Headers[k] = v
+		}
+		for k, v := range c.Headers {
+			t.Headers[k] = v
+		}
+	}
+	if t.Method != "" && !methodPattern.MatchString(t.Method) {
+		return checker.Target{}, fmt.Errorf("无效的请求方法 %q", t.Method)
+	}
+
+	if timeout := firstNonEmpty(c.Timeout, defaults.Timeout); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return checker.Target{}, fmt.Errorf("无效的超时时间 %q", timeout)
+		}
+		t.Timeout = d
+	}
+	if interval := firstNonEmpty(c.Interval, defaults.Interval); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return checker.Target{}, fmt.Errorf("无效的检查间隔 %q", interval)
+		}
+		t.Interval = d
+	}
+	if certWarn := firstNonEmpty(c.CertWarn, defaults.CertWarn); certWarn != "" {
+		d, err := checker.ParseCertWarn(certWarn)
+		if err != nil {
+			return checker.Target{}, err
+		}
+		t.CertWarn = d
+		if d == 0 {
+			t.CertWarn = -1 // 明确写了 0，不再使用 -cert-warn 参数
+		}
+	}
+	t.Insecure = c.Insecure || defaults.Insecure
+	t.FreshConn = c.FreshConn || defaults.FreshConn
+
+	expect := c.Expect
+	if expect == nil {
+		expect = defaults.Expect
+	}
+	var err error
+	if t.Expect, err = expect.build(); err != nil {
+		return checker.Target{}, err
+	}
+	retry := c.Retry
+	if retry == nil {
+		retry = defaults.Retry
+	}
+	if t.Retry, err = retry.build(); err != nil {
+		return checker.Target{}, fmt.Errorf("retry: %v", err)
+	}
+	redirect := c.Redirect
+	if redirect == nil {
+		redirect = defaults.Redirect
+	}
+	if t.Redirect, err = redirect.build(); err != nil {
+		return checker.Target{}, fmt.Errorf("redirect: %v", err)
+	}
+	hostLimit := c.HostLimit
+	if hostLimit == nil {
+		hostLimit = defaults.HostLimit
+	}
+	if t.HostLimit, err = hostLimit.build(); err != nil {
+		return checker.Target{}, fmt.Errorf("host_limit: %v", err)
+	}
+	return t, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// targetStream 逐个把目标交给 yield，yield 返回 false 时停止读取。
+// 读取出错时返回错误，已经交出去的目标不受影响。
+type targetStream func(yield func(checker.Target) bool) error
+
+// openTargets 打开目标列表，path 为 "-" 时从 stdin 读取。以 .json 结尾的文件按配置文件解析，
+// 其他文件按旧的 urls.txt 格式解析：每行一个 URL；标准输入以 { 开头时按配置文件解析。
+// URL 列表在调用返回的 targetStream 时边读边交出，不会把整个文件读进内存，几千万行也没问题；
+// 配置文件要整个解析才能报告出错的行号，所以在这里就解析完，格式错误直接返回错误（配置文件是手写的，不会很大）。
+func openTargets(path string, stdin io.Reader) (targetStream, error) {
+	var r *bufio.Reader
+	var closer io.Closer
+	isConfig := strings.EqualFold(filepath.Ext(path), ".json")
+	if path == "-" {
+		path = "<stdin>"
+		r = bufio.NewReader(stdin)
+		isConfig = startsWithBrace(r)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r, closer = bufio.NewReader(f), f
+	}
+
+	if isConfig {
+		data, err := io.ReadAll(r)
+		if closer != nil {
+			closer.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		targets, err := parseConfig(path, data)
+		if err != nil {
+			return nil, err
+		}
+		return func(yield func(checker.Target) bool) error {
+			for _, t := range targets {
+				if !yield(t) {
+					break
+				}
+			}
+			return nil
+		}, nil
+	}
+	return func(yield func(checker.Target) bool) error {
+		if closer != nil {
+			defer closer.Close()
+		}
+		return scanURLList(r, yield)
+	}, nil
+}
+
+// startsWithBrace 判断 r 中第一个非空白字符是不是 {，只偷看不消耗
+func startsWithBrace(r *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		buf, err := r.Peek(n)
+		if err != nil {
+			return false
+		}
+		switch c := buf[n-1]; c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c == '{'
+		}
+	}
+}
+
+// loadTargets 读取整个目标列表，监控模式需要反复检查所有目标，只能全部放在内存里
+func loadTargets(path string, stdin io.Reader) ([]checker.Target, error) {
+	stream, err := openTargets(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	var targets []checker.Target
+	err = stream(func(t checker.Target) bool {
+		targets = append(targets, t)
+		return true
+	})
+	return targets, err
+}
+
+// scanURLList 逐行读取旧的 urls.txt 格式交给 yield，跳过空行和 # 开头的注释，每次只在内存中保留一行
+func scanURLList(r io.Reader, yield func(checker.Target) bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !yield(checker.Target{URL: line}) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// parseConfig 解析 JSON 配置文件。
+// 知识点：这里没有直接 json.Unmarshal 整个文件，而是用 json.Decoder 逐个 Token 读取，
+// 这样可以通过 InputOffset 记下每个目标在文件中的位置，出错时能告诉用户是第几行。
+func parseConfig(path string, data []byte) ([]checker.Target, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	fail := func(offset int64, format string, args ...any) error {
+		return fmt.Errorf("%s:%d: %s", path, lineAt(data, offset), fmt.Sprintf(format, args...))
+	}
+	// 语法错误的 Offset 是相对整个文件的，并且指向出错字符之后，减一才是出错字符本身
+	syntaxFail := func(offset int64, prefix string, err error) error {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset - 1
+		}
+		return fail(offset, "%s%v", prefix, err)
+	}
+	expectDelim := func(want json.Delim) error {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return syntaxFail(offset, "", err)
+		}
+		if tok != want {
+			return fail(valueStart(data, offset), "期望 %q, 但得到了 %v", want, tok)
+		}
+		return nil
+	}
+	// decodeValue 先把下一个值整体读成 RawMessage，再单独解码到 v 中。
+	// 单独解码时类型错误的 Offset 是相对这个值的开头的，加上 start 就得到在文件中的位置。
+	decodeValue := func(v any, prefix string) (int64, error) {
+		offset := dec.InputOffset()
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return 0, syntaxFail(offset, prefix, err)
+		}
+		start := valueStart(data, offset)
+		inner := json.NewDecoder(bytes.NewReader(raw))
+		inner.DisallowUnknownFields() // 拼错的字段名直接报错，而不是被悄悄忽略
+		if err := inner.Decode(v); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return 0, fail(start+typeErr.Offset-1, "%s%v", prefix, err)
+			}
+			return 0, fail(start, "%s%v", prefix, err)
+		}
+		return start, nil
+	}
+
+	var defaults targetConfig
+	var configs []targetConfig
+	var starts []int64
+
+	if err := expectDelim('{'); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, syntaxFail(offset, "", err)
+		}
+		switch tok {
+		case "defaults":
+			if _, err := decodeValue(&defaults, "defaults: "); err != nil {
+				return nil, err
+			}
+		case "targets":
+			if err := expectDelim('['); err != nil {
+				return nil, err
+			}
+			for dec.More() {
+				var c targetConfig
+				start, err := decodeValue(&c, fmt.Sprintf("第 %d 个目标: ", len(configs)+1))
+				if err != nil {
+					return nil, err
+				}
+				configs = append(configs, c)
+				starts = append(starts, start)
+			}
+			if err := expectDelim(']'); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fail(valueStart(data, offset), "未知的配置项 %v", tok)
+		}
+	}
+	if err := expectDelim('}'); err != nil {
+		return nil, err
+	}
+
+	if defaults.URL != "" || defaults.Name != "" {
+		return nil, fmt.Errorf("%s: defaults 中不能设置 url 和 name", path)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s: 没有配置任何目标", path)
+	}
+
+	targets := make([]checker.Target, 0, len(configs))
+	for i, c := range configs {
+		t, err := c.toTarget(defaults)
+		if err != nil {
+			label := fmt.Sprintf("第 %d 个目标", i+1)
+			if c.Name != "" {
+				label += fmt.Sprintf(" (%s)", c.Name)
+			}
+			return nil, fail(starts[i], "%s: %v", label, err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// valueStart 跳过空白、逗号和冒号，找到下一个值真正开始的位置。
+// InputOffset 指向上一个 Token 之后，中间可能还隔着这些字符。
+func valueStart(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// lineAt 计算 offset 所在的行号
+func lineAt(data []byte, offset int64) int {
+	offset = max(0, min(offset, int64(len(data))))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
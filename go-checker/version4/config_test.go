@@ -0,0 +1,222 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestParseConfig(t *testing.T) {
+	data := []byte(`{
+  "defaults": {"timeout": "2s", "headers": {"User-Agent": "go-checker"}, "tags": ["prod"]},
+  "targets": [
+    {"name": "首页", "url": "https://example.com"},
+    {
+      "name": "登录", "url": "https://example.com/login", "method": "post",
+      "headers": {"Content-Type": "application/json"},
+      "expect": {"status": "200,401", "json": {"code": 0}}
+    },
+    {"name": "数据库", "url": "tcp://127.0.0.1:3306", "tags": ["db"]}
+  ]
+}`)
+	targets, err := parseConfig("checks.json", data)
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("期望 3 个目标, 但得到了 %d 个", len(targets))
+	}
+
+	login := targets[1]
+	if login.Method != "POST" || login.Timeout != 2*time.Second {
+		t.Errorf("期望 POST 和 2s 超时, 但得到了 %s 和 %v", login.Method, login.Timeout)
+	}
+	if login.Headers["User-Agent"] != "go-checker" || login.Headers["Content-Type"] != "application/json" {
+		t.Errorf("期望合并默认请求头, 但得到了 %v", login.Headers)
+	}
+	if login.Expect == nil || len(login.Expect.Status) != 2 {
+		t.Errorf("期望解析出状态码断言, 但得到了 %+v", login.Expect)
+	}
+
+	// 非 HTTP 目标不继承 HTTP 相关的默认值
+	db := targets[2]
+	if len(db.Headers) != 0 || strings.Join(db.Tags, ",") != "prod,db" {
+		t.Errorf("数据库目标的默认值合并错误: %+v", db)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "语法错误",
+			data: "{\n  \"targets\": [\n    {\"url\": \"https://a.com\",}\n  ]\n}",
+			want: "checks.json:3:",
+		},
+		{
+			name: "未知字段",
+			data: "{\"targets\": [\n  {\"url\": \"https://a.com\"},\n  {\"url\": \"https://b.com\", \"metod\": \"GET\"}\n]}",
+			want: "checks.json:3: 第 2 个目标",
+		},
+		{
+			name: "类型错误",
+			data: "{\"targets\": [\n  {\"url\": \"https://a.com\",\n   \"tags\": \"web\"}\n]}",
+			want: "checks.json:3: 第 1 个目标",
+		},
+		{
+			name: "无效的超时",
+			data: "{\"targets\": [\n  {\"url\": \"https://a.com\"},\n\n  {\"name\": \"b\", \"url\": \"https://b.com\", \"timeout\": \"soon\"}\n]}",
+			want: `checks.json:4: 第 2 个目标 (b): 无效的超时时间 "soon"`,
+		},
+		{
+			name: "非 HTTP 目标配置断言",
+			data: "{\"targets\": [\n  {\"url\": \"tcp://db:3306\", \"expect\": {\"status\": \"200\"}}\n]}",
+			want: "checks.json:2: 第 1 个目标",
+		},
+		{
+			name: "缺少 url",
+			data: `{"targets": [{"name": "a"}]}`,
+			want: "缺少 url",
+		},
+	}
+	for _, tt := range tests {
+		_, err := parseConfig("checks.json", []byte(tt.data))
+		if err == nil {
+			t.Errorf("%s: 期望得到错误，但没有得到", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: 期望错误包含 %q, 但得到了 %q", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestParseURLList(t *testing.T) {
+	targets, err := loadTargets("-", strings.NewReader("https://a.com\n\n# 注释\n  https://b.com  \n"))
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	if len(targets) != 2 || targets[1].URL != "https://b.com" {
+		t.Errorf("期望得到 2 个目标, 但得到了 %+v", targets)
+	}
+}
+
+func TestParseRetryConfig(t *testing.T) {
+	targets, err := parseConfig("checks.json", []byte(`{"targets": [
+  {"url": "https://a.com", "retry": {"attempts": 3, "on": ["timeout"], "status": ""}}
+]}`))
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	p := targets[0].Retry
+	if p.MaxAttempts != 3 || len(p.RetryOn) != 1 || len(p.RetryStatus) != 0 || p.BaseDelay != 200*time.Millisecond {
+		t.Errorf("重试配置解析错误: %+v", p)
+	}
+
+	_, err = parseConfig("checks.json", []byte(`{"targets": [
+  {"url": "https://a.com"},
+  {"url": "https://b.com", "retry": {"attempts": 2, "on": ["flaky"]}}
+]}`))
+	if err == nil || !strings.Contains(err.Error(), "checks.json:3: 第 2 个目标") {
+		t.Errorf("期望无效的错误类别指向第 2 个目标, 但得到了 %v", err)
+	}
+}
+
+func TestRedirectConfig(t *testing.T) {
+	targets, err := parseConfig("checks.json", []byte(`{"defaults": {"redirect": {"max": 3}}, "targets": [
+  {"url": "https://a.com"},
+  {"url": "https://b.com", "redirect": {"follow": false}}
+]}`))
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	if p := targets[0].Redirect; !p.Follow || p.MaxHops != 3 {
+		t.Errorf("期望继承默认的重定向策略, 但得到了 %+v", p)
+	}
+	if p := targets[1].Redirect; p.Follow {
+		t.Errorf("期望不跟随重定向, 但得到了 %+v", p)
+	}
+
+	// max 为 0 和 -max-redirects 0 一样表示不跟随，而不是每次重定向都报错
+	targets, err = parseConfig("checks.json", []byte(`{"targets": [{"url": "https://a.com", "redirect": {"max": 0}}]}`))
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	if p := targets[0].Redirect; p.Follow || p.MaxHops != 0 {
+		t.Errorf("期望 max 为 0 时不跟随重定向, 但得到了 %+v", p)
+	}
+	_, err = parseConfig("checks.json", []byte(`{"targets": [{"url": "https://a.com", "redirect": {"follow": true, "max": 0}}]}`))
+	if err == nil {
+		t.Error("期望 follow 为 true 时 max 不能为 0")
+	}
+
+	_, err = parseConfig("checks.json", []byte(`{"targets": [{"url": "tcp://a.com:80", "redirect": {"max": 1}}]}`))
+	if err == nil {
+		t.Error("期望 tcp 目标不能设置 redirect")
+	}
+}
+
+func TestFreshConnConfig(t *testing.T) {
+	targets, err := parseConfig("checks.json", []byte(`{"defaults": {"fresh_conn": true}, "targets": [
+  {"url": "https://a.com"},
+  {"url": "tcp://b.com:22"}
+]}`))
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	if !targets[0].FreshConn || targets[1].FreshConn {
+		t.Errorf("期望只有 http 目标继承 fresh_conn, 但得到了 %v 和 %v", targets[0].FreshConn, targets[1].FreshConn)
+	}
+	if _, err := parseConfig("checks.json", []byte(`{"targets": [{"url": "tcp://b.com:22", "fresh_conn": true}]}`)); err == nil {
+		t.Error("期望 tcp 目标使用 fresh_conn 时报错，但没有得到错误")
+	}
+}
+
+func TestHostLimitConfig(t *testing.T) {
+	targets, err := parseConfig("checks.json", []byte(`{"defaults": {"host_limit": {"rps": 2}}, "targets": [
+  {"url": "https://a.com"},
+  {"url": "tcp://b.com:22"},
+  {"url": "https://c.com", "host_limit": {"max_concurrent": 1}}
+]}`))
+	if err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	for i, want := range []checker.HostLimit{{RPS: 2}, {RPS: 2}, {MaxConcurrent: 1}} {
+		if got := targets[i].HostLimit; got == nil || *got != want {
+			t.Errorf("目标 %d: 期望主机限制 %+v, 但得到了 %+v", i, want, got)
+		}
+	}
+	if _, err := parseConfig("checks.json", []byte(`{"targets": [{"url": "https://a.com", "host_limit": {"rps": -1}}]}`)); err == nil {
+		t.Error("期望 rps 为负数时报错，但没有得到错误")
+	}
+}
+
+func TestOpenTargetsStream(t *testing.T) {
+	// 读到第 2 个目标就停下，后面的行不应该再被读取
+	var got []string
+	stream, err := openTargets("-", strings.NewReader("https://a.com\nhttps://b.com\nhttps://c.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream(func(t checker.Target) bool {
+		got = append(got, t.URL)
+		return len(got) < 2
+	})
+	if err != nil || len(got) != 2 {
+		t.Errorf("期望 yield 返回 false 后停止读取, 但得到了 %v %v", got, err)
+	}
+
+	// 标准输入以 { 开头时按配置文件解析
+	targets, err := loadTargets("-", strings.NewReader("\n  {\"targets\": [{\"name\": \"a\", \"url\": \"https://a.com\"}]}"))
+	if err != nil || len(targets) != 1 || targets[0].Name != "a" {
+		t.Errorf("期望从标准输入读取配置文件, 但得到了 %+v %v", targets, err)
+	}
+	if _, err := openTargets("-", strings.NewReader(`{"targets": [}`)); err == nil || !strings.HasPrefix(err.Error(), "<stdin>:1:") {
+		t.Errorf("期望配置文件的格式错误在打开时就返回, 但得到了 %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// crawlUserAgent 是爬取时使用的 User-Agent，robots.txt 中可以针对它写规则
+const crawlUserAgent = "go-checker"
+
+// robotsRules 是 robots.txt 中适用于 go-checker 的规则。
+// 规则是路径前缀，支持 * 匹配任意字符、结尾的 $ 表示匹配到路径的末尾（RFC 9309）
+type robotsRules struct {
+	allow, disallow []string
+}
+
+// parseRobots 解析 robots.txt。有针对 agent 的分组时使用它，否则使用 User-agent: * 的分组。
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	var specific, star robotsRules
+	var matchedSpecific bool
+	var groupAgents []string
+	inRules := false // 上一行是规则，再遇到 User-agent 就是新的分组
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if inRules {
+				groupAgents, inRules = nil, false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue // "Disallow:" 为空表示不限制
+			}
+			for _, a := range groupAgents {
+				var rules *robotsRules
+				switch {
+				case a == "*":
+					rules = &star
+				case strings.Contains(agent, a):
+					rules, matchedSpecific = &specific, true
+				default:
+					continue
+				}
+				if key == "allow" {
+					rules.allow = append(rules.allow, value)
+				} else {
+					rules.disallow = append(rules.disallow, value)
+				}
+			}
+		}
+	}
+	if matchedSpecific {
+		return &specific
+	}
+	return &star
+}
+
+// allowed 判断一个路径（可以带查询参数）能否抓取：匹配的规则中最长的生效，长度相同时 Allow 优先
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	longest := func(patterns []string) int {
+		n := -1
+		for _, p := range patterns {
+			if len(p) > n && robotsMatch(p, path) {
+				n = len(p)
+			}
+		}
+		return n
+	}
+	return longest(r.allow) >= longest(r.disallow)
+}
+
+// robotsMatch 判断 path 是否匹配一条规则。
+// 知识点：按 * 把规则切成几段，第一段必须是前缀，之后每一段在剩下的路径中找最靠前的位置；
+// 结尾有 $ 时最后一段必须是后缀。每一段都取最靠前的位置，给后面的段留下最多的空间，不需要回溯
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path, parts = path[len(parts[0]):], parts[1:]
+	if anchored {
+		if len(parts) == 0 {
+			return path == ""
+		}
+		last := parts[len(parts)-1]
+		if !strings.HasSuffix(path, last) {
+			return false
+		}
+		path, parts = path[:len(path)-len(last)], parts[:len(parts)-1]
+	}
+	for _, part := range parts {
+		i := strings.Index(path, part)
+		if i < 0 {
+			return false
+		}
+		path = path[i+len(part):]
+	}
+	return true
+}
+
+// Crawler 从站点的根地址出发，自己发现并检查页面上的链接
+type Crawler struct {
+	Root     *url.URL
+	MaxDepth int            // 最多跟随几层链接，根页面是第 0 层
+	External bool           // 是否检查外部链接（只检查一次，不会继续爬）
+	Base     checker.Target // 每个任务的模板，超时、重试、断言等从这里来
+}
+
+func NewCrawler(root string, maxDepth int, external bool, base checker.Target) (*Crawler, error) {
+	u, err := url.Parse(root)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: 爬取的起点必须是 http(s) 地址: %q", checker.ErrInvalidTarget, root)
+	}
+	if u.Path == "" {
+		u.Path = "/" // 页面上指向首页的链接是 http://host/，统一成一样的写法才能去重
+	}
+	return &Crawler{Root: u, MaxDepth: maxDepth, External: external, Base: base}, nil
+}
+
+// internal 判断链接是不是站内的：和根地址是同一个服务，主机名不区分大小写，默认端口写不写都一样
+func (c *Crawler) internal(u *url.URL) bool {
+	return checker.ServiceKey(u) == checker.ServiceKey(c.Root)
+}
+
+// target 为一个链接生成任务，站内的页面没有到达最大深度时才需要解析其中的链接
+func (c *Crawler) target(link, foundOn string, depth int, internal bool) checker.Target {
+	t := c.Base
+	t.URL = link
+	t.FoundOn = foundOn
+	t.CollectLinks = internal && depth < c.MaxDepth
+	t.Headers = map[string]string{"User-Agent": crawlUserAgent}
+	for k, v := range c.Base.Headers {
+		t.Headers[k] = v
+	}
+	return t
+}
+
+// fetchRobots 下载站点的 robots.txt，不存在或下载失败时不做限制。
+// 和页面一样通过 opts.Client 的 Transport 下载，使用相同的超时、请求头和 -insecure 设置
+func (c *Crawler) fetchRobots(ctx context.Context, opts checker.Options) *robotsRules {
+	t := c.target(c.Root.ResolveReference(&url.URL{Path: "/robots.txt"}).String(), "", 0, false)
+	t.Method, t.Body = http.MethodGet, ""
+	resp, err := checker.HTTPChecker{Client: opts.Client}.Fetch(ctx, t)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	defer io.Copy(io.Discard, resp.Body) // 读完响应体连接才能复用
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, checker.MaxAssertBody), crawlUserAgent)
+}
+
+// Run 爬取整个站点，每个结果交给 onResult。
+// 知识点：新发现的链接先放进本地队列，再用 select 同时“发送任务”和“接收结果”，
+// 如果直接往 jobs 里写，jobs 满了之后调度者和 worker 会互相等待而死锁。
+func (c *Crawler) Run(ctx context.Context, opts checker.Options, onResult func(checker.Result)) {
+	robots := c.fetchRobots(ctx, opts)
+
+	jobs := make(chan checker.Target)
+	results := checker.RunStream(ctx, jobs, opts)
+	defer close(jobs)
+
+	root := c.Root.String()
+	seen := map[string]bool{root: true}
+	depth := map[string]int{root: 0}
+	queue := []checker.Target{c.target(root, "", 0, true)}
+	pending := 0 // 已经发出、还没有拿到结果的任务数
+
+	for len(queue) > 0 || pending > 0 {
+		// 队列为空时 send 为 nil，select 不会选中这个分支
+		var send chan<- checker.Target
+		var next checker.Target
+		if len(queue) > 0 {
+			send, next = jobs, queue[0]
+		}
+		select {
+		case send <- next:
+			queue = queue[1:]
+			pending++
+		case res := <-results:
+			pending--
+			onResult(res)
+			for _, link := range res.Links {
+				if seen[link] {
+					continue
+				}
+				seen[link] = true
+				u, _ := url.Parse(link)
+				internal := c.internal(u)
+				switch {
+				case !internal && !c.External:
+					continue
+				case internal && !robots.allowed(u.RequestURI()):
+					fmt.Fprintf(progress, "robots.txt 不允许抓取 %s，已跳过\n", link)
+					continue
+				}
+				d := depth[res.URL] + 1
+				depth[link] = d
+				queue = append(queue, c.target(link, res.URL, d, internal))
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := `# 注释
+User-agent: *
+Disallow: /private
+Disallow:
+
+User-agent: Go-Checker
+User-agent: other
+Disallow: /admin
+Allow: /admin/public
+`
+	rules := parseRobots(strings.NewReader(robots), crawlUserAgent)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/private/x", true}, // 有针对 go-checker 的分组时不再使用 * 的规则
+		{"/admin", false},
+		{"/admin/users", false},
+		{"/admin/public/page", true}, // 更长的 Allow 优先
+	}
+	for _, tt := range tests {
+		if got := rules.allowed(tt.path); got != tt.want {
+			t.Errorf("%s: 期望 %v, 但得到了 %v", tt.path, tt.want, got)
+		}
+	}
+
+	rules = parseRobots(strings.NewReader(robots), "somebot")
+	if rules.allowed("/private/x") || !rules.allowed("/admin") {
+		t.Errorf("没有专门的分组时应该使用 * 的规则, 但得到了 %+v", rules)
+	}
+
+	robots = `User-agent: *
+Disallow: /*.pdf$
+Disallow: /*?session=
+Disallow: /tmp$
+Allow: /*/public/
+Disallow: /users/
+`
+	rules = parseRobots(strings.NewReader(robots), crawlUserAgent)
+	tests = []struct {
+		path string
+		want bool
+	}{
+		{"/docs/a.pdf", false},
+		{"/docs/a.pdf?x=1", true}, // $ 要求匹配到末尾
+		{"/docs/a.pdfx", true},
+		{"/search?session=1&q=go", false},
+		{"/search?q=go", true},
+		{"/tmp", false},
+		{"/tmp/x", true},
+		{"/users/1", false},
+		{"/users/public/1", true}, // /*/public/ 比 /users/ 长，Allow 生效
+		{"/users/1/public/", true},
+	}
+	for _, tt := range tests {
+		if got := rules.allowed(tt.path); got != tt.want {
+			t.Errorf("%s: 期望 %v, 但得到了 %v", tt.path, tt.want, got)
+		}
+	}
+
+	var none *robotsRules // 没有 robots.txt
+	if !none.allowed("/anything") {
+		t.Error("没有 robots.txt 时应该允许抓取")
+	}
+}
+
+// crawlSite 是一个测试用的站点，记录每个路径被请求了几次
+type crawlSite struct {
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (s *crawlSite) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// newCrawlSite 返回一个站点：
+//
+//	/ → /a, /private/secret, 外部页面
+//	/a → /b, /missing (404), /style.css
+//	/b → /c（超过深度 2，不应该被请求）
+func newCrawlSite(t *testing.T, external string) (*httptest.Server, *crawlSite) {
+	t.Helper()
+	site := &crawlSite{requests: make(map[string]int)}
+	pages := map[string]string{
+		"/":  fmt.Sprintf(`<a href="/a">A</a> <a href="/private/secret">私有</a> <a href="%s/page">外部</a>`, external),
+		"/a": `<a href="b">B</a> <a href="/missing">坏链接</a> <link href="/style.css"> <a href="/">首页</a>`,
+		"/b": `<a href="/c">C</a>`,
+		"/c": `最深的页面`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.requests[r.URL.Path]++
+		site.mu.Unlock()
+		if r.Header.Get("User-Agent") != crawlUserAgent {
+			t.Errorf("期望 User-Agent 为 %s, 但得到了 %q", crawlUserAgent, r.Header.Get("User-Agent"))
+		}
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, `a { background: url("/from-css.png") }`)
+		default:
+			page, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, page)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, site
+}
+
+func TestCrawler(t *testing.T) {
+	external := &crawlSite{requests: make(map[string]int)}
+	externalServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		external.mu.Lock()
+		external.requests[r.URL.Path]++
+		external.mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/deeper">外部站点的链接不应该被跟随</a>`)
+	}))
+	defer externalServer.Close()
+	server, site := newCrawlSite(t, externalServer.URL)
+
+	var buf bytes.Buffer
+	oldProgress := progress
+	progress = &buf
+	defer func() { progress = oldProgress }()
+
+	crawler, err := NewCrawler(server.URL, 2, true, checker.Target{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string]checker.Result)
+	crawler.Run(context.Background(), checker.Options{Concurrency: 3}, func(res checker.Result) {
+		if _, dup := results[res.URL]; dup {
+			t.Errorf("%s 被检查了不止一次", res.URL)
+		}
+		results[res.URL] = res
+	})
+
+	want := map[string]string{ // 链接 → 发现它的页面
+		server.URL + "/":             "",
+		server.URL + "/a":            server.URL + "/",
+		externalServer.URL + "/page": server.URL + "/",
+		server.URL + "/b":            server.URL + "/a",
+		server.URL + "/missing":      server.URL + "/a",
+		server.URL + "/style.css":    server.URL + "/a",
+	}
+	if len(results) != len(want) {
+		t.Errorf("期望检查 %d 个链接, 但得到了 %d 个: %v", len(want), len(results), slices.Collect(maps.Keys(results)))
+	}
+	for link, foundOn := range want {
+		res, ok := results[link]
+		if !ok {
+			t.Errorf("期望检查 %s, 但没有", link)
+			continue
+		}
+		if res.FoundOn != foundOn {
+			t.Errorf("%s: 期望发现于 %q, 但得到了 %q", link, foundOn, res.FoundOn)
+		}
+		if len(res.Links) > 0 && link != server.URL+"/" && link != server.URL+"/a" {
+			t.Errorf("%s 已经到达最大深度或不是站内页面, 不应该解析链接: %v", link, res.Links)
+		}
+	}
+	if res := results[server.URL+"/missing"]; res.OK() || res.StatusCode != 404 {
+		t.Errorf("期望 /missing 失败, 但得到了 %d %v", res.StatusCode, res.Error)
+	}
+
+	if n := site.count("/private/secret"); n != 0 {
+		t.Errorf("robots.txt 不允许抓取 /private, 但它被请求了 %d 次", n)
+	}
+	if !strings.Contains(buf.String(), "/private/secret") {
+		t.Errorf("期望提示跳过了 /private/secret, 但得到了 %q", buf.String())
+	}
+	if n := site.count("/c"); n != 0 {
+		t.Errorf("/c 超过了最大深度, 但它被请求了 %d 次", n)
+	}
+	if n := external.count("/deeper"); n != 0 {
+		t.Errorf("外部链接不应该继续爬取, 但 /deeper 被请求了 %d 次", n)
+	}
+
+	// 文本报告中列出失效链接和它所在的页面
+	var all []checker.Result
+	for _, res := range results {
+		all = append(all, res)
+	}
+	report := writeReport(t, "text", all)
+	if !strings.Contains(report, "--- 失效链接 ---\n"+server.URL+"/missing") ||
+		!strings.Contains(report, "出现在 "+server.URL+"/a") {
+		t.Errorf("文本报告中没有失效链接:\n%s", report)
+	}
+}
+
+func TestCrawlerSkipsExternal(t *testing.T) {
+	server, _ := newCrawlSite(t, "http://external.invalid")
+	crawler, err := NewCrawler(server.URL, 1, false, checker.Target{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checked []string
+	crawler.Run(context.Background(), checker.Options{Concurrency: 2}, func(res checker.Result) { checked = append(checked, res.URL) })
+	slices.Sort(checked)
+	want := []string{server.URL + "/", server.URL + "/a"}
+	if !slices.Equal(checked, want) {
+		t.Errorf("期望只检查 %v, 但得到了 %v", want, checked)
+	}
+}
+
+// robots.txt 和页面一样按照 Base 的设置下载：自签名证书的站点配合 Insecure 也要遵守 robots.txt
+func TestCrawlerRobotsInsecure(t *testing.T) {
+	var mu sync.Mutex
+	var private int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			t.Errorf("%s: 期望带有 Base 中的请求头", r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		case "/private":
+			mu.Lock()
+			private++
+			mu.Unlock()
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/private">私有</a>`)
+		}
+	}))
+	defer server.Close()
+
+	oldProgress := progress
+	progress = io.Discard
+	defer func() { progress = oldProgress }()
+
+	crawler, err := NewCrawler(server.URL, 1, false, checker.Target{Insecure: true, Headers: map[string]string{"X-Token": "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run(context.Background(), checker.Options{Concurrency: 1}, func(checker.Result) {})
+	if private != 0 {
+		t.Errorf("robots.txt 不允许抓取 /private, 但它被请求了 %d 次", private)
+	}
+}
+
+func TestCrawlerInternal(t *testing.T) {
+	crawler, err := NewCrawler("https://Example.com/docs", 1, false, checker.Target{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{"https://example.com/a", true},
+		{"https://EXAMPLE.COM/a", true},     // 主机名不区分大小写
+		{"https://example.com:443/a", true}, // 写上默认端口还是同一个站点
+		{"http://example.com/a", false},     // 不同的 scheme 是不同的服务
+		{"https://example.com:8443/a", false},
+		{"https://www.example.com/a", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.link)
+		if got := crawler.internal(u); got != tt.want {
+			t.Errorf("%s: 期望 %v, 但得到了 %v", tt.link, tt.want, got)
+		}
+	}
+}
+
+func TestNewCrawlerInvalidRoot(t *testing.T) {
+	for _, root := range []string{"", "example.com", "tcp://example.com:80", "https://"} {
+		if _, err := NewCrawler(root, 1, true, checker.Target{}); err == nil {
+			t.Errorf("%q: 期望返回错误, 但没有", root)
+		}
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// -tui 仪表盘的参数
+const (
+	dashboardRefresh     = 100 * time.Millisecond // 重绘的间隔
+	maxDashboardFailures = 1000                   // 失败列表最多保留的条数，更早的只计数
+	maxSparkPoints       = 120                    // 延迟走势最多保留多少秒
+	maxDashboardLogs     = 100                    // 运行期间最多保留的日志行数
+)
+
+// 知识点：终端控制序列（ANSI escape code）以 ESC [ 开头，
+// 备用屏幕和 vim、less 用的一样，退出后终端恢复成运行之前的内容。
+const (
+	ansiEnterAltScreen = "\x1b[?1049h\x1b[?25l" // 切换到备用屏幕并隐藏光标
+	ansiLeaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	ansiHome           = "\x1b[H"  // 光标移到左上角
+	ansiClearLine      = "\x1b[K"  // 清除到行尾
+	ansiClearBelow     = "\x1b[J"  // 清除到屏幕末尾
+	ansiReverse        = "\x1b[7m" // 反色，用于标题行
+	ansiReset          = "\x1b[0m"
+)
+
+// dashboardFailure 是失败列表中的一行，只保存显示需要的文本
+type dashboardFailure struct {
+	target string
+	text   string
+}
+
+// dashboard 是 -tui 时的实时仪表盘：进度条、成功和失败的数量、每个 worker 正在检查的目标、
+// 每秒平均延迟的走势，以及可以滚动的失败列表。
+// worker 的钩子和收集结果的 goroutine 并发地更新状态，重绘的 goroutine 定时读取，所以都要加锁
+type dashboard struct {
+	out     io.Writer
+	fd      int      // 输出终端，用来查询窗口大小
+	keys    *os.File // 读取按键的终端，打不开时为 nil，不能滚动
+	quit    func()   // 按 q 时调用
+	restore func()   // 恢复终端设置
+	stop    chan struct{}
+	wg      sync.WaitGroup
+
+	mu         sync.Mutex
+	started    time.Time
+	total      int  // 已经读到的目标数
+	totalKnown bool // 目标列表已经读完，total 就是全部目标数；爬取模式下一直是 false
+	workers    []string
+	done       int
+	ok         int
+	failed     int
+	warn       int
+	skipped    int // 主机熔断而跳过的数量，包含在 failed 中
+	canceled   int // 被取消的数量，包含在 failed 中
+	latency    LatencyRecorder
+	spark      []time.Duration // 每秒成功检查的平均延迟，最新的在最后，没有检查的秒为 0
+	sparkSum   time.Duration
+	sparkN     int
+	sparkAt    time.Time // 当前这一秒开始的时间
+	failures   []dashboardFailure
+	dropped    int  // 超过 maxDashboardFailures 被丢掉的失败数
+	scroll     int  // 失败列表第一行显示的是第几个失败
+	follow     bool // 滚动到底部时跟随新的失败
+	page       int  // 上次绘制时失败列表的行数，翻页用
+	logs       []string
+	notices    []string // 关闭之后才打印的提示，见 notice
+	closed     bool
+}
+
+// newDashboard 在 out 上打开仪表盘，workers 是 worker 的数量。out 不是终端时返回错误
+func newDashboard(out *os.File, workers int, quit func()) (*dashboard, error) {
+	fd := int(out.Fd())
+	if !isTerminal(fd) {
+		return nil, fmt.Errorf("%s 不是终端", out.Name())
+	}
+	now := time.Now()
+	d := &dashboard{out: out, fd: fd, quit: quit, stop: make(chan struct{}),
+		started: now, sparkAt: now, workers: make([]string, workers), follow: true}
+
+	// 按键从 /dev/tty 读取，标准输入可能是目标列表（-file -）
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		if restore, err := makeCbreak(int(tty.Fd())); err == nil {
+			d.keys, d.restore = tty, restore
+		} else {
+			tty.Close()
+		}
+	}
+	io.WriteString(out, ansiEnterAltScreen)
+	// 运行期间的日志显示在仪表盘底部，不然会把画面弄乱
+	log.SetOutput(d)
+
+	d.wg.Add(1)
+	go d.loop()
+	if d.keys != nil {
+		go d.readKeys()
+	}
+	signalDashboard.Store(d)
+	return d, nil
+}
+
+// close 关闭仪表盘，恢复终端，把运行期间的日志和提示输出到标准错误
+func (d *dashboard) close() {
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	d.wg.Wait()
+	d.restoreTerminal()
+	if d.keys != nil {
+		d.keys.Close() // readKeys 中阻塞的 Read 会返回错误
+	}
+	signalDashboard.CompareAndSwap(d, nil)
+	log.SetOutput(os.Stderr)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	for _, line := range d.logs {
+		log.Print(line)
+	}
+	for _, line := range d.notices {
+		log.Print(line)
+	}
+}
+
+// restoreTerminal 离开备用屏幕并恢复终端设置。close 会调用它，
+// 强制退出时不会执行 close，收到第二次信号时也要直接调用
+func (d *dashboard) restoreTerminal() {
+	io.WriteString(d.out, ansiLeaveAltScreen)
+	if d.restore != nil {
+		d.restore()
+	}
+}
+
+// notice 记下一条提示，等仪表盘关闭、回到正常的屏幕之后再打印。
+// d 为 nil 或者已经关闭时返回 false，由调用者自己打印
+func (d *dashboard) notice(msg string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.notices = append(d.notices, msg)
+	return true
+}
+
+// Write 实现 io.Writer，接收 log 包的输出
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for line := range strings.Lines(string(p)) {
+		d.logs = append(d.logs, strings.TrimRight(line, "\n"))
+	}
+	if n := len(d.logs); n > maxDashboardLogs {
+		d.logs = d.logs[n-maxDashboardLogs:]
+	}
+	return len(p), nil
+}
+
+// start 是 Options.OnStart 钩子，记录 worker 开始检查的目标
+func (d *dashboard) start(worker int, t checker.Target) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.workers) < worker {
+		d.workers = append(d.workers, "")
+	}
+	d.workers[worker-1] = t.URL
+}
+
+// addTarget 记录读到了一个目标
+func (d *dashboard) addTarget() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.total++
+}
+
+// inputClosed 记录目标列表已经读完
+func (d *dashboard) inputClosed() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.totalKnown = true
+}
+
+// observe 统计一个结果
+func (d *dashboard) observe(res checker.Result) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.done++
+	// 结果里没有 worker 编号，按 URL 找到检查它的 worker，同一个 URL 同时在检查时清掉哪个都一样
+	if i := slices.Index(d.workers, res.URL); i >= 0 {
+		d.workers[i] = ""
+	}
+	if res.OK() {
+		d.ok++
+		if res.Warn() {
+			d.warn++
+		}
+		d.latency.Add(res.Latency)
+		d.sparkSum += res.Latency
+		d.sparkN++
+		return
+	}
+	d.failed++
+	switch res.Category() {
+	case checker.CategoryCanceled:
+		d.canceled++
+		return // 取消之后剩下的目标都是这样，不放进失败列表
+	case checker.CategorySkipped:
+		d.skipped++
+	}
+	d.failures = append(d.failures, dashboardFailure{target: resultKey(res), text: errorText(res)})
+	if len(d.failures) > maxDashboardFailures {
+		d.failures = d.failures[1:]
+		d.dropped++
+		d.scroll = max(d.scroll-1, 0)
+	}
+}
+
+// loop 定时重绘，直到 close
+func (d *dashboard) loop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		d.draw()
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// draw 把整个画面写到终端。每行都清除到行尾，不需要先清屏，画面不会闪
+func (d *dashboard) draw() {
+	width, height, ok := terminalSize(d.fd)
+	if !ok {
+		width, height = 80, 24
+	}
+	d.mu.Lock()
+	lines := d.render(time.Now(), width, height)
+	d.mu.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(ansiHome)
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(line)
+		buf.WriteString(ansiClearLine)
+	}
+	buf.WriteString(ansiClearBelow)
+	d.out.Write(buf.Bytes())
+}
+
+// render 生成 width 列、height 行以内的画面，调用者持有 d.mu
+func (d *dashboard) render(now time.Time, width, height int) []string {
+	d.rollSpark(now)
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, fitWidth(fmt.Sprintf(format, args...), width))
+	}
+
+	elapsed := now.Sub(d.started)
+	lines = append(lines, ansiReverse+padWidth(fitWidth(fmt.Sprintf(" go-checker  已运行 %v  q 停止  ↑↓/PgUp/PgDn 滚动失败列表",
+		elapsed.Truncate(time.Second)), width), width)+ansiReset)
+	switch {
+	case d.totalKnown && d.total > 0:
+		add("%s %d/%d %5.1f%%", progressBar(float64(d.done)/float64(d.total), width/2), d.done, d.total, 100*float64(d.done)/float64(d.total))
+	case d.total > 0:
+		add("%s %d/%d+（目标列表还在读取）", progressBar(float64(d.done)/float64(d.total), width/2), d.done, d.total)
+	default:
+		add("已完成 %d", d.done)
+	}
+	inFlight := 0
+	for _, url := range d.workers {
+		if url != "" {
+			inFlight++
+		}
+	}
+	var rate float64
+	if s := elapsed.Seconds(); s > 0 {
+		rate = float64(d.done) / s
+	}
+	add("成功 %d  失败 %d（跳过 %d，取消 %d）  警告 %d  进行中 %d/%d  %.1f 个/秒",
+		d.ok, d.failed, d.skipped, d.canceled, d.warn, inFlight, len(d.workers), rate)
+	if l := d.latency.Stats(); l.Count > 0 {
+		r := func(d time.Duration) time.Duration { return d.Round(100 * time.Microsecond) }
+		add("延迟 P50 %v  P95 %v  P99 %v  最大 %v", r(l.P50), r(l.P95), r(l.P99), r(l.Max))
+	} else {
+		add("延迟 -")
+	}
+	const sparkLabel = "每秒平均延迟 "
+	add("%s%s", sparkLabel, sparkline(d.spark, width-displayWidth(sparkLabel)-16)) // 后面还有“最高 xxx”
+
+	// 剩下的行平分给 worker 和失败列表，worker 最多占一半
+	rest := height - len(lines) - 4 // 两个标题、一个空行、底部的日志
+	workerRows := min(len(d.workers), max(rest/2, 1))
+	if workerRows < len(d.workers) {
+		workerRows = max(workerRows-1, 0) // 留一行写还有多少个 worker
+	}
+	add("")
+	add("Worker（进行中 %d）", inFlight)
+	for i, url := range d.workers[:workerRows] {
+		if url == "" {
+			url = "-"
+		}
+		add("%4d  %s", i+1, url)
+	}
+	if n := len(d.workers) - workerRows; n > 0 {
+		add("      ... 还有 %d 个 worker", n)
+	}
+
+	d.page = max(height-len(lines)-2, 1)
+	if d.dropped > 0 {
+		add("失败（%d，只保留最近 %d 条）", len(d.failures)+d.dropped, maxDashboardFailures)
+	} else {
+		add("失败（%d）", len(d.failures))
+	}
+	bottom := max(len(d.failures)-d.page, 0)
+	if d.follow || d.scroll > bottom {
+		d.scroll = bottom
+	}
+	for _, f := range d.failures[d.scroll:min(d.scroll+d.page, len(d.failures))] {
+		add("  %s  %s", f.target, f.text)
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	if len(d.logs) > 0 {
+		add("%s", d.logs[len(d.logs)-1])
+	}
+	return lines[:min(len(lines), height)]
+}
+
+// rollSpark 把已经结束的每一秒的平均延迟加入走势，调用者持有 d.mu
+func (d *dashboard) rollSpark(now time.Time) {
+	for now.Sub(d.sparkAt) >= time.Second {
+		var avg time.Duration
+		if d.sparkN > 0 {
+			avg = d.sparkSum / time.Duration(d.sparkN)
+		}
+		d.spark = append(d.spark, avg)
+		if len(d.spark) > maxSparkPoints {
+			d.spark = d.spark[1:]
+		}
+		d.sparkSum, d.sparkN = 0, 0
+		d.sparkAt = d.sparkAt.Add(time.Second)
+	}
+}
+
+// 仪表盘的按键
+const (
+	keyUp = iota
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyTop
+	keyBottom
+	keyQuit
+)
+
+// readKeys 读取按键，直到终端被关闭
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := d.keys.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			if k == keyQuit {
+				d.quit()
+				continue
+			}
+			d.mu.Lock()
+			d.scrollBy(k)
+			d.mu.Unlock()
+		}
+	}
+}
+
+// parseKeys 把读到的字节解析成按键，不认识的忽略。方向键和翻页键是以 ESC [ 开头的序列
+func parseKeys(b []byte) []int {
+	var keys []int
+	for len(b) > 0 {
+		switch {
+		case bytes.HasPrefix(b, []byte("\x1b[A")):
+			keys, b = append(keys, keyUp), b[3:]
+		case bytes.HasPrefix(b, []byte("\x1b[B")):
+			keys, b = append(keys, keyDown), b[3:]
+		case bytes.HasPrefix(b, []byte("\x1b[5~")):
+			keys, b = append(keys, keyPageUp), b[4:]
+		case bytes.HasPrefix(b, []byte("\x1b[6~")):
+			keys, b = append(keys, keyPageDown), b[4:]
+		default:
+			switch b[0] {
+			case 'k':
+				keys = append(keys, keyUp)
+			case 'j':
+				keys = append(keys, keyDown)
+			case 'g':
+				keys = append(keys, keyTop)
+			case 'G':
+				keys = append(keys, keyBottom)
+			case 'q':
+				keys = append(keys, keyQuit)
+			}
+			b = b[1:]
+		}
+	}
+	return keys
+}
+
+// scrollBy 按按键滚动失败列表，调用者持有 d.mu
+func (d *dashboard) scrollBy(k int) {
+	bottom := max(len(d.failures)-d.page, 0)
+	switch k {
+	case keyUp:
+		d.scroll--
+	case keyDown:
+		d.scroll++
+	case keyPageUp:
+		d.scroll -= d.page
+	case keyPageDown:
+		d.scroll += d.page
+	case keyTop:
+		d.scroll = 0
+	case keyBottom:
+		d.scroll = bottom
+	}
+	d.scroll = min(max(d.scroll, 0), bottom)
+	d.follow = d.scroll == bottom
+}
+
+// progressBar 画一个 width 格宽的进度条
+func progressBar(frac float64, width int) string {
+	width = max(width, 10)
+	filled := int(min(max(frac, 0), 1) * float64(width))
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline 用高低不同的方块画出最近 width 个值的走势，按其中的最大值缩放，0 画成空格
+func sparkline(values []time.Duration, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	var peak time.Duration
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if v <= 0 {
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteRune(sparkBlocks[int(int64(v)*int64(len(sparkBlocks)-1)/int64(peak))])
+	}
+	if peak > 0 {
+		fmt.Fprintf(&b, " 最高 %v", peak.Round(time.Millisecond))
+	}
+	return b.String()
+}
+
+// runeWidth 返回一个字符在终端中占的列数，中日韩文字和全角符号占两列
+func runeWidth(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115F, r >= 0x2E80 && r <= 0xA4CF, r >= 0xAC00 && r <= 0xD7A3,
+		r >= 0xF900 && r <= 0xFAFF, r >= 0xFE30 && r <= 0xFE4F, r >= 0xFF00 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE6:
+		return 2
+	}
+	return 1
+}
+
+// displayWidth 返回字符串在终端中占的列数
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// fitWidth 把 s 截断到不超过 width 列，超出的行会折到下一行，把画面弄乱
+func fitWidth(s string, width int) string {
+	w := 0
+	for i, r := range s {
+		if r == utf8.RuneError || r < ' ' {
+			return s[:i] // 控制字符可能移动光标，不输出
+		}
+		if w += runeWidth(r); w > width {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// padWidth 在 s 后面补空格到 width 列
+func padWidth(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-displayWidth(s), 0))
+}
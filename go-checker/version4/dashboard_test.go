@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// newTestDashboard 返回一个不连接终端的仪表盘，只用来测试状态和绘制
+func newTestDashboard(workers int) *dashboard {
+	now := time.Now()
+	return &dashboard{started: now, sparkAt: now, workers: make([]string, workers), follow: true}
+}
+
+func TestDashboardRender(t *testing.T) {
+	d := newTestDashboard(2)
+	for range 4 {
+		d.addTarget()
+	}
+	d.inputClosed()
+	d.start(1, checker.Target{URL: "https://a.com"})
+	d.start(2, checker.Target{URL: "https://b.com"})
+	d.observe(checker.Result{URL: "https://a.com", Latency: 100 * time.Millisecond})
+	d.observe(checker.Result{URL: "https://c.com", Error: errors.New("connection refused")})
+
+	lines := d.render(d.started.Add(2*time.Second), 80, 20)
+	if len(lines) > 20 {
+		t.Errorf("期望画面不超过 20 行, 但得到了 %d 行", len(lines))
+	}
+	screen := strings.Join(lines, "\n")
+	for _, want := range []string{"2/4  50.0%", "成功 1  失败 1", "进行中 1/2", "   1  -", "   2  https://b.com", "失败（1）", "https://c.com  connection refused"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("期望画面中有 %q, 但得到了:\n%s", want, screen)
+		}
+	}
+	for _, line := range lines[1:] { // 第一行带有颜色控制序列
+		if w := displayWidth(line); w > 80 {
+			t.Errorf("期望每行不超过 80 列, 但 %q 有 %d 列", line, w)
+		}
+	}
+}
+
+func TestDashboardScroll(t *testing.T) {
+	d := newTestDashboard(1)
+	d.page = 5
+	for i := range 20 {
+		d.observe(checker.Result{URL: "https://a.com/" + string(rune('a'+i)), Error: errors.New("timeout")})
+	}
+	d.render(time.Now(), 80, 12)
+	bottom := len(d.failures) - d.page
+	if d.scroll != bottom {
+		t.Fatalf("期望默认跟随最新的失败, scroll 应为 %d, 但得到了 %d", bottom, d.scroll)
+	}
+	for _, k := range parseKeys([]byte("\x1b[Ak\x1b[5~")) {
+		d.scrollBy(k)
+	}
+	if d.scroll != bottom-2-d.page || d.follow {
+		t.Errorf("期望向上滚动了 2 行和一页, 但 scroll 为 %d", d.scroll)
+	}
+	d.scrollBy(keyTop)
+	d.scrollBy(keyUp)
+	if d.scroll != 0 {
+		t.Errorf("期望不能滚动到第一行之前, 但 scroll 为 %d", d.scroll)
+	}
+	d.scrollBy(keyBottom)
+	if d.scroll != bottom || !d.follow {
+		t.Errorf("期望回到底部之后继续跟随, 但 scroll 为 %d", d.scroll)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[B\x1b[6~gGxq"))
+	want := []int{keyDown, keyDown, keyPageDown, keyTop, keyBottom, keyQuit}
+	if !slices.Equal(got, want) {
+		t.Errorf("期望 %v, 但得到了 %v", want, got)
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"成功数量", 5, "成功"}, // 中文占两列
+		{"a\x1b[2Jb", 10, "a"},
+	}
+	for _, tt := range tests {
+		if got := fitWidth(tt.in, tt.width); got != tt.want {
+			t.Errorf("fitWidth(%q, %d): 期望 %q, 但得到了 %q", tt.in, tt.width, tt.want, got)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	values := []time.Duration{0, 10 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond}
+	if got := sparkline(values, 3); got != "▁▄█ 最高 80ms" {
+		t.Errorf("期望只画最近 3 个值, 但得到了 %q", got)
+	}
+	if got := sparkline(values, 10); !strings.HasPrefix(got, " ▁") {
+		t.Errorf("期望没有数据的一秒画成空格, 但得到了 %q", got)
+	}
+}
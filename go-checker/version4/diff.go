@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// errRegression 表示 diff 发现了新增失败或延迟变慢，子命令以退出码 1 结束，方便在 CI 中使用
+var errRegression = errors.New("发现了新增失败或延迟变慢的目标")
+
+// latencyChange 是一个目标在两次运行之间的延迟变化
+type latencyChange struct {
+	Key      string
+	From, To time.Duration
+}
+
+// delta 返回变慢的比例，如 +200%。上次的延迟为 0 时算不出比例，改为输出增加了多少时间
+func (c latencyChange) delta() string {
+	if c.From <= 0 {
+		return "+" + (c.To - c.From).Round(time.Microsecond).String()
+	}
+	return fmt.Sprintf("+%.0f%%", (float64(c.To)/float64(c.From)-1)*100)
+}
+
+// RunDiff 是两次运行的比较结果
+type RunDiff struct {
+	NewlyFailing []historyRecord // 上次成功、这次失败，记录的是这次的结果
+	Recovered    []historyRecord // 上次失败、这次成功
+	Regressions  []latencyChange // 两次都成功，但延迟明显变慢
+	Added        []string        // 这次才有的目标
+	Removed      []string        // 上次有、这次没有的目标
+}
+
+// diffRuns 比较两次运行。延迟变慢需要同时满足：比上次慢了 threshold 倍以上（0.5 表示慢了 50%），
+// 并且至少慢了 minDelta，避免几毫秒的小波动也被当成变慢。
+func diffRuns(from, to *runSummary, threshold float64, minDelta time.Duration) RunDiff {
+	var d RunDiff
+	for key, b := range to.Targets {
+		a, ok := from.Targets[key]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, key)
+		case a.OK && !b.OK:
+			d.NewlyFailing = append(d.NewlyFailing, b)
+		case !a.OK && b.OK:
+			d.Recovered = append(d.Recovered, b)
+		case a.OK && b.OK:
+			before, after := msDuration(a.LatencyMS), msDuration(b.LatencyMS)
+			if after-before >= minDelta && float64(after) > float64(before)*(1+threshold) {
+				d.Regressions = append(d.Regressions, latencyChange{Key: key, From: before, To: after})
+			}
+		}
+	}
+	for key := range from.Targets {
+		if _, ok := to.Targets[key]; !ok {
+			d.Removed = append(d.Removed, key)
+		}
+	}
+
+	// map 的遍历顺序是随机的，排序后输出稳定
+	byKey := func(a, b historyRecord) int { return strings.Compare(a.key(), b.key()) }
+	slices.SortFunc(d.NewlyFailing, byKey)
+	slices.SortFunc(d.Recovered, byKey)
+	slices.SortFunc(d.Regressions, func(a, b latencyChange) int { return strings.Compare(a.Key, b.Key) })
+	slices.Sort(d.Added)
+	slices.Sort(d.Removed)
+	return d
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// runDiff 实现 diff 子命令：
+//
+//	go-checker diff [-history 文件] [-threshold 0.5] [-min-delta 50ms] [旧的运行 新的运行]
+//
+// 不指定运行 ID 时比较最近的两次运行。发现新增失败或延迟变慢时返回 errRegression。
+func runDiff(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	path := fs.String("history", defaultHistoryFile, "历史文件")
+	threshold := fs.Float64("threshold", 0.5, "延迟比上次慢了多少比例算作变慢，0.5 表示 50%")
+	minDelta := fs.Duration("min-delta", 50*time.Millisecond, "延迟至少慢了多少才算作变慢")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	records, err := readHistory(*path)
+	if err != nil {
+		return err
+	}
+	runs := groupRuns(records)
+
+	var from, to *runSummary
+	switch fs.NArg() {
+	case 0:
+		if len(runs) < 2 {
+			return fmt.Errorf("历史记录中只有 %d 次运行，至少需要 2 次", len(runs))
+		}
+		from, to = runs[len(runs)-2], runs[len(runs)-1]
+	case 2:
+		if from = findRun(runs, fs.Arg(0)); from == nil {
+			return fmt.Errorf("历史记录中没有运行 %q", fs.Arg(0))
+		}
+		if to = findRun(runs, fs.Arg(1)); to == nil {
+			return fmt.Errorf("历史记录中没有运行 %q", fs.Arg(1))
+		}
+	default:
+		return errors.New("用法: go-checker diff [参数] [旧的运行 新的运行]")
+	}
+
+	d := diffRuns(from, to, *threshold, *minDelta)
+	printDiff(out, from, to, d)
+	if len(d.NewlyFailing) > 0 || len(d.Regressions) > 0 {
+		return errRegression
+	}
+	return nil
+}
+
+func findRun(runs []*runSummary, id string) *runSummary {
+	for _, run := range runs {
+		if run.RunID == id {
+			return run
+		}
+	}
+	return nil
+}
+
+// printDiff 打印比较结果，没有变化的部分不打印
+func printDiff(out io.Writer, from, to *runSummary, d RunDiff) {
+	fmt.Fprintf(out, "比较 %s → %s\n", from.RunID, to.RunID)
+	if len(d.NewlyFailing)+len(d.Recovered)+len(d.Regressions)+len(d.Added)+len(d.Removed) == 0 {
+		fmt.Fprintln(out, "没有变化")
+		return
+	}
+	if len(d.NewlyFailing) > 0 {
+		fmt.Fprintf(out, "\n--- 新增失败 (%d) ---\n", len(d.NewlyFailing))
+		for _, rec := range d.NewlyFailing {
+			reason := rec.Error
+			if reason == "" && len(rec.Failures) > 0 {
+				reason = "断言失败: " + rec.Failures[0]
+			}
+			fmt.Fprintf(out, "  ✗ %s: %s\n", rec.key(), reason)
+		}
+	}
+	if len(d.Recovered) > 0 {
+		fmt.Fprintf(out, "\n--- 已恢复 (%d) ---\n", len(d.Recovered))
+		for _, rec := range d.Recovered {
+			fmt.Fprintf(out, "  ✓ %s\n", rec.key())
+		}
+	}
+	if len(d.Regressions) > 0 {
+		fmt.Fprintf(out, "\n--- 延迟变慢 (%d) ---\n", len(d.Regressions))
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		for _, c := range d.Regressions {
+			fmt.Fprintf(w, "  %s\t%v → %v\t%s\n", c.Key, c.From.Round(time.Microsecond), c.To.Round(time.Microsecond), c.delta())
+		}
+		w.Flush()
+	}
+	if len(d.Added) > 0 {
+		fmt.Fprintf(out, "\n--- 新增目标 (%d) ---\n", len(d.Added))
+		for _, key := range d.Added {
+			fmt.Fprintf(out, "  + %s\n", key)
+		}
+	}
+	if len(d.Removed) > 0 {
+		fmt.Fprintf(out, "\n--- 消失的目标 (%d) ---\n", len(d.Removed))
+		for _, key := range d.Removed {
+			fmt.Fprintf(out, "  - %s\n", key)
+		}
+	}
+}
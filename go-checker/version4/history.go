@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// defaultHistoryFile 是 history 和 diff 子命令默认读取的历史文件
+const defaultHistoryFile = "go-checker-history.ndjson"
+
+// historyRecord 是历史文件中的一行：哪次运行、什么时间、检查结果
+type historyRecord struct {
+	RunID string    `json:"run_id"`
+	Time  time.Time `json:"time"`
+	resultRecord
+}
+
+// key 是目标在历史记录中的标识，和 resultKey 一致
+func (r historyRecord) key() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.URL
+}
+
+// HistoryStore 把每次运行的结果追加到一个 NDJSON 文件中。
+// 知识点：只追加不修改的文件最简单也最可靠，程序中途被杀掉最多丢掉最后一行，
+// 而且用 grep、jq 等工具就能直接查看，不需要引入数据库。
+type HistoryStore struct {
+	mu    sync.Mutex
+	f     *os.File
+	runID string
+	start time.Time
+	round time.Duration // 大于 0 时每隔这么久开始一次新的运行，见 RotateEvery
+}
+
+// newRunID 用开始时间生成运行 ID，按字符串排序就是按时间排序
+func newRunID(start time.Time) string {
+	return start.Format("20060102-150405.000")
+}
+
+// OpenHistory 以追加模式打开历史文件，文件不存在时创建
+func OpenHistory(path, runID string) (*HistoryStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryStore{f: f, runID: runID}, nil
+}
+
+// RotateEvery 让监控模式每隔 round 开始一次新的运行：结果按检查时间归入从 start 开始的第几轮，
+// 运行 ID 是这一轮的开始时间，diff 比较的就是最近两轮，而不是整个进程只有一次运行
+func (h *HistoryStore) RotateEvery(start time.Time, round time.Duration) {
+	h.start, h.round = start, round
+}
+
+// Append 追加一个检查结果，每个结果单独一次写入，被取消的检查不记录
+func (h *HistoryStore) Append(res checker.Result, at time.Time) error {
+	if res.Category() == checker.CategoryCanceled {
+		return nil
+	}
+	runID := h.runID
+	if h.round > 0 {
+		runID = newRunID(h.start.Add(at.Sub(h.start) / h.round * h.round))
+	}
+	data, err := json.Marshal(historyRecord{RunID: runID, Time: at, resultRecord: newResultRecord(res)})
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.f.Write(append(data, '\n'))
+	return err
+}
+
+func (h *HistoryStore) Close() error {
+	return h.f.Close()
+}
+
+// readHistory 读取历史文件中的所有记录，损坏的行（如写了一半）会被跳过
+func readHistory(path string) ([]historyRecord, error) {
+	var records []historyRecord
+	err := scanHistory(path, func(rec historyRecord) {
+		records = append(records, rec)
+	})
+	return records, err
+}
+
+// scanHistory 逐行读取历史文件，每条记录交给 fn，不把整个文件放进内存
+func scanHistory(path string, fn func(historyRecord)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // 一行可能很长，比如带着很长的错误信息
+	for scanner.Scan() {
+		var rec historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.RunID == "" {
+			continue
+		}
+		fn(rec)
+	}
+	return scanner.Err()
+}
+
+// historyState 是一个目标在历史记录中最后的状态
+type historyState struct {
+	State State
+	Since time.Time // 连续处于这个状态的第一条记录的时间
+	Last  time.Time // 最后一条记录的时间
+}
+
+// lastStates 读取每个目标最后的状态，内存只和目标的数量有关，和历史文件的大小无关
+func lastStates(path string) (map[string]historyState, error) {
+	states := make(map[string]historyState)
+	err := scanHistory(path, func(rec historyRecord) {
+		st, ok := states[rec.key()]
+		if !ok || st.State != rec.State {
+			st = historyState{State: rec.State, Since: rec.Time}
+		}
+		st.Last = rec.Time
+		states[rec.key()] = st
+	})
+	return states, err
+}
+
+// runSummary 是历史文件中一次运行的概况
+type runSummary struct {
+	RunID   string
+	Start   time.Time
+	Total   int
+	Fail    int
+	Targets map[string]historyRecord // 每个目标在这次运行中的最后一个结果
+}
+
+// groupRuns 按运行 ID 分组，按时间先后排序
+func groupRuns(records []historyRecord) []*runSummary {
+	byID := make(map[string]*runSummary)
+	var runs []*runSummary
+	for _, rec := range records {
+		run, ok := byID[rec.RunID]
+		if !ok {
+			run = &runSummary{RunID: rec.RunID, Start: rec.Time, Targets: make(map[string]historyRecord)}
+			byID[rec.RunID] = run
+			runs = append(runs, run)
+		}
+		run.Total++
+		if !rec.OK {
+			run.Fail++
+		}
+		run.Targets[rec.key()] = rec
+	}
+	slices.SortStableFunc(runs, func(a, b *runSummary) int { return a.Start.Compare(b.Start) })
+	return runs
+}
+
+// runHistory 实现 history 子命令：
+//
+//	go-checker history [-history 文件] [-n 20]           列出最近的运行
+//	go-checker history [-history 文件] [-n 20] <目标>    列出一个目标最近的结果，目标可以是名称或 URL
+func runHistory(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	path := fs.String("history", defaultHistoryFile, "历史文件")
+	limit := fs.Int("n", 20, "最多显示多少条")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	records, err := readHistory(*path)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	if fs.NArg() == 0 {
+		runs := groupRuns(records)
+		fmt.Fprintln(w, "Run\tStart\tTotal\tFail\t")
+		for _, run := range runs[max(len(runs)-*limit, 0):] {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t\n", run.RunID, run.Start.Format("2006-01-02 15:04:05"), run.Total, run.Fail)
+		}
+		return w.Flush()
+	}
+
+	target := fs.Arg(0)
+	var matched []historyRecord
+	for _, rec := range records {
+		if rec.Name == target || rec.URL == target {
+			matched = append(matched, rec)
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("历史记录中没有目标 %q", target)
+	}
+	fmt.Fprintln(w, "Run\tTime\tState\tStatusCode\tLatency\tError\t")
+	for _, rec := range matched[max(len(matched)-*limit, 0):] {
+		status, errText := "N/A", "N/A"
+		if rec.StatusCode != 0 {
+			status = fmt.Sprint(rec.StatusCode)
+		}
+		if rec.Error != "" {
+			errText = rec.Error
+		} else if len(rec.Failures) > 0 {
+			errText = "断言失败: " + rec.Failures[0]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%s\t\n", rec.RunID, rec.Time.Format("2006-01-02 15:04:05"), rec.State, status,
+			msDuration(rec.LatencyMS).Round(time.Microsecond), errText)
+	}
+	return w.Flush()
+}
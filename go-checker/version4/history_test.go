@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// writeRuns 把两次运行写到一个临时的历史文件中
+func writeRuns(t *testing.T, runs ...[]checker.Result) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.ndjson")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, results := range runs {
+		at := start.Add(time.Duration(i) * time.Hour)
+		h, err := OpenHistory(path, newRunID(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, res := range results {
+			if err := h.Append(res, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		h.Close()
+	}
+	return path
+}
+
+func TestHistoryDiff(t *testing.T) {
+	ok := func(name string, latency time.Duration) checker.Result {
+		return checker.Result{Name: name, URL: "https://" + name, StatusCode: 200, Latency: latency}
+	}
+	fail := func(name string) checker.Result {
+		return checker.Result{Name: name, URL: "https://" + name, Error: errors.New("connection refused")}
+	}
+	path := writeRuns(t,
+		[]checker.Result{ok("a", 100*time.Millisecond), ok("b", 100*time.Millisecond), fail("c"), ok("d", 10*time.Millisecond), ok("old", time.Millisecond)},
+		[]checker.Result{fail("a"), ok("b", 300*time.Millisecond), ok("c", time.Millisecond), ok("d", 30*time.Millisecond), ok("new", time.Millisecond)},
+	)
+	// 写了一半的行应该被跳过
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"run_id": "broken`)
+	f.Close()
+
+	records, err := readHistory(path)
+	if err != nil || len(records) != 10 {
+		t.Fatalf("期望读到 10 条记录, 但得到了 %d 条 %v", len(records), err)
+	}
+	runs := groupRuns(records)
+	if len(runs) != 2 || runs[0].Fail != 1 || runs[1].Total != 5 {
+		t.Fatalf("运行分组错误: %+v %+v", runs[0], runs[1])
+	}
+
+	d := diffRuns(runs[0], runs[1], 0.5, 50*time.Millisecond)
+	if len(d.NewlyFailing) != 1 || d.NewlyFailing[0].Name != "a" {
+		t.Errorf("期望 a 是新增失败, 但得到了 %v", d.NewlyFailing)
+	}
+	if len(d.Recovered) != 1 || d.Recovered[0].Name != "c" {
+		t.Errorf("期望 c 已恢复, 但得到了 %v", d.Recovered)
+	}
+	// d 虽然慢了两倍，但只慢了 20ms，不算变慢
+	if len(d.Regressions) != 1 || d.Regressions[0].Key != "b" {
+		t.Errorf("期望只有 b 延迟变慢, 但得到了 %v", d.Regressions)
+	}
+	if strings.Join(d.Added, ",") != "new" || strings.Join(d.Removed, ",") != "old" {
+		t.Errorf("新增和消失的目标错误: %v %v", d.Added, d.Removed)
+	}
+
+	var buf bytes.Buffer
+	if err := runDiff([]string{"-history", path}, &buf); !errors.Is(err, errRegression) {
+		t.Errorf("期望 diff 返回 errRegression, 但得到了 %v", err)
+	}
+	if !strings.Contains(buf.String(), "新增失败 (1)") || !strings.Contains(buf.String(), "+200%") {
+		t.Errorf("diff 输出错误:\n%s", buf.String())
+	}
+}
+
+func TestLatencyChangeDelta(t *testing.T) {
+	if got := (latencyChange{From: 100 * time.Millisecond, To: 300 * time.Millisecond}).delta(); got != "+200%" {
+		t.Errorf("期望 +200%%, 但得到了 %q", got)
+	}
+	if got := (latencyChange{To: 80 * time.Millisecond}).delta(); got != "+80ms" {
+		t.Errorf("期望上次延迟为 0 时输出增加的时间, 但得到了 %q", got)
+	}
+}
+
+func TestHistoryRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.ndjson")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h, err := OpenHistory(path, newRunID(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.RotateEvery(start, time.Minute)
+	res := checker.Result{URL: "https://a.com", StatusCode: 200}
+	for _, at := range []time.Duration{10 * time.Second, 50 * time.Second, 70 * time.Second, 3 * time.Minute} {
+		if err := h.Append(res, start.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Close()
+
+	records, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := groupRuns(records)
+	want := []string{newRunID(start), newRunID(start.Add(time.Minute)), newRunID(start.Add(3 * time.Minute))}
+	if len(runs) != len(want) {
+		t.Fatalf("期望 %d 次运行, 但得到了 %d 次", len(want), len(runs))
+	}
+	for i, run := range runs {
+		if run.RunID != want[i] {
+			t.Errorf("第 %d 次运行: 期望运行 ID %s, 但得到了 %s", i+1, want[i], run.RunID)
+		}
+	}
+}
+
+func TestLastStates(t *testing.T) {
+	up := checker.Result{URL: "https://a.com", StatusCode: 200}
+	down := checker.Result{URL: "https://a.com", Error: errors.New("timeout")}
+	path := writeRuns(t, []checker.Result{up}, []checker.Result{down}, []checker.Result{down})
+
+	states, err := lastStates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := historyState{State: StateDown, Since: start.Add(time.Hour), Last: start.Add(2 * time.Hour)}
+	if got := states["https://a.com"]; len(states) != 1 || got != want {
+		t.Errorf("期望 %+v, 但得到了 %+v", want, states)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	res := checker.Result{Name: "首页", URL: "https://a.com", StatusCode: 200, Latency: time.Millisecond}
+	path := writeRuns(t, []checker.Result{res}, []checker.Result{res}, []checker.Result{res})
+
+	var buf bytes.Buffer
+	if err := runHistory([]string{"-history", path, "-n", "2", "https://a.com"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	// 表头加最近 2 条
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[2], "20240101-020000.000") {
+		t.Errorf("history 输出错误:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := runHistory([]string{"-history", path}, &buf); err != nil || strings.Count(buf.String(), "20240101-") != 3 {
+		t.Errorf("期望列出 3 次运行, 但得到了 %v:\n%s", err, buf.String())
+	}
+	if err := runHistory([]string{"-history", path, "不存在"}, &buf); err == nil {
+		t.Error("期望查询不存在的目标时返回错误")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// 知识点：go:embed 在编译时把文件内容放进变量里，程序运行时不需要模板文件，
+// 生成的 HTML 也把样式、脚本和 SVG 图表都写在一个文件里，发给别人直接用浏览器打开就能看。
+//
+//go:embed report.html.tmpl
+var htmlTemplateText string
+
+// htmlTemplate 中定义了 head、row、middle、failure、foot 几个片段，按顺序拼成整个页面。
+// html/template 会按上下文转义 URL 和错误信息，目标里有 <script> 之类的内容也不会被执行
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":          func(d time.Duration) string { return fmt.Sprintf("%.1f", milliseconds(d)) },
+	"phaseNames":  func() []string { return phaseNames },
+	"phaseColors": func() []string { return phaseColors },
+}).Parse(htmlTemplateText))
+
+// htmlWriter 生成 -html 的报告。和 junitWriter 一样，统计信息在页面的最前面，只能在最后写出，
+// 所以表格的每一行和失败详情先分别写到临时文件里，Close 时再按顺序拼起来
+type htmlWriter struct {
+	out      io.Writer
+	rows     *os.File
+	failures *os.File
+	n        int // 已经写了多少行，用作行和失败详情的锚点
+}
+
+func newHTMLWriter(out io.Writer) *htmlWriter {
+	return &htmlWriter{out: out}
+}
+
+// htmlRow 是表格中的一行
+type htmlRow struct {
+	ID         int
+	State      State
+	Name       string
+	URL        string
+	Kind       string
+	StatusCode int
+	Latency    time.Duration
+	Category   string
+	Text       string
+	Failed     bool // 有失败详情可以跳转
+}
+
+// htmlFailure 是一个失败目标的详情
+type htmlFailure struct {
+	ID            int
+	Name          string
+	URL           string
+	Category      string
+	Error         string
+	Failures      []string
+	AttemptErrors []string
+	Attempts      int
+	StatusCode    int
+	Latency       time.Duration
+	Phases        []htmlPhase
+	Hops          []checker.Hop
+	FoundOn       string
+}
+
+// htmlPhase 是阶段耗时条形图中的一段，Offset 和 Width 是占总耗时的百分比
+type htmlPhase struct {
+	Name          string
+	Duration      time.Duration
+	Offset, Width float64
+	Color         string
+}
+
+// 各阶段的名称和在图中的颜色，顺序和 PhaseTiming 的字段一致
+var (
+	phaseNames  = []string{"DNS", "连接", "TLS", "TTFB", "下载"}
+	phaseColors = []string{"#8e7cc3", "#6fa8dc", "#93c47d", "#f6b26b", "#e06666"}
+)
+
+// newHTMLPhases 把各阶段耗时画成一条首尾相接的条形，没有计时信息时返回 nil
+func newHTMLPhases(t *checker.PhaseTiming) []htmlPhase {
+	if t == nil {
+		return nil
+	}
+	phases := make([]htmlPhase, len(phaseNames))
+	var total time.Duration
+	for i, d := range []time.Duration{t.DNS, t.Connect, t.TLS, t.TTFB, t.Download} {
+		phases[i] = htmlPhase{Name: phaseNames[i], Duration: d, Color: phaseColors[i]}
+		total += d
+	}
+	var offset float64
+	for i := range phases {
+		if total > 0 {
+			phases[i].Offset = offset
+			phases[i].Width = 100 * float64(phases[i].Duration) / float64(total)
+			offset += phases[i].Width
+		}
+	}
+	return phases
+}
+
+func (h *htmlWriter) WriteResult(res checker.Result) error {
+	if h.rows == nil {
+		rows, err := os.CreateTemp("", "go-checker-html-rows-*")
+		if err != nil {
+			return err
+		}
+		failures, err := os.CreateTemp("", "go-checker-html-failures-*")
+		if err != nil {
+			rows.Close()
+			os.Remove(rows.Name())
+			return err
+		}
+		h.rows, h.failures = rows, failures
+	}
+	h.n++
+	text := errorText(res)
+	if text == "N/A" {
+		text = res.Detail
+	}
+	row := htmlRow{ID: h.n, State: stateOf(res), Name: res.Name, URL: res.URL, Kind: res.Kind, StatusCode: res.StatusCode,
+		Latency: res.Latency, Category: res.Category(), Text: text, Failed: !res.OK()}
+	if err := htmlTemplate.ExecuteTemplate(h.rows, "row", row); err != nil {
+		return err
+	}
+	if res.OK() {
+		return nil
+	}
+
+	f := htmlFailure{ID: h.n, Name: res.Name, URL: res.URL, Category: res.Category(), Failures: res.Failures,
+		Attempts: res.Attempts, StatusCode: res.StatusCode, Latency: res.Latency, Phases: newHTMLPhases(res.Timing), FoundOn: res.FoundOn}
+	if res.Error != nil {
+		f.Error = res.Error.Error()
+	}
+	for _, err := range res.AttemptErrors {
+		f.AttemptErrors = append(f.AttemptErrors, err.Error())
+	}
+	if len(res.Hops) > 1 {
+		f.Hops = res.Hops
+	}
+	return htmlTemplate.ExecuteTemplate(h.failures, "failure", f)
+}
+
+// htmlPage 是页面中除了表格行和失败详情之外的部分
+type htmlPage struct {
+	Generated time.Time
+	Summary   Summary
+	Failed    int
+	Segments  []htmlSegment // 成功、警告、失败的比例条
+	Bars      []htmlBar     // 延迟分布图
+	ChartW    int
+	ChartH    int
+}
+
+// htmlSegment 是比例条中的一段，Offset 和 Width 是百分比
+type htmlSegment struct {
+	Label         string
+	Count         int
+	Offset, Width float64
+	Class         string
+}
+
+// htmlBar 是延迟分布图中的一个柱子，坐标是 SVG 中的像素
+type htmlBar struct {
+	X, Y, W, H float64
+	Label      string
+	Count      int
+}
+
+// 延迟分布图的大小
+const (
+	htmlChartW      = 720
+	htmlChartH      = 220
+	htmlChartMargin = 24 // 上方留给数字、下方留给桶的标签
+)
+
+// newHTMLPage 根据统计信息算出比例条和延迟分布图
+func newHTMLPage(s Summary) htmlPage {
+	p := htmlPage{Generated: time.Now(), Summary: s, Failed: s.Fail, ChartW: htmlChartW, ChartH: htmlChartH}
+	var offset float64
+	for _, seg := range []htmlSegment{
+		{Label: "成功", Count: s.Success - s.Warn, Class: "up"},
+		{Label: "警告", Count: s.Warn, Class: "warn"},
+		{Label: "失败", Count: s.Fail, Class: "down"},
+	} {
+		if seg.Count == 0 || s.Total == 0 {
+			continue
+		}
+		seg.Offset = offset
+		seg.Width = 100 * float64(seg.Count) / float64(s.Total)
+		offset += seg.Width
+		p.Segments = append(p.Segments, seg)
+	}
+
+	// 和文本报告的直方图一样，省略两端没有数据的桶
+	first, last, peak := -1, -1, 0
+	for i, b := range s.Histogram {
+		if b.Count > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			peak = max(peak, b.Count)
+		}
+	}
+	if first < 0 {
+		return p
+	}
+	buckets := s.Histogram[first : last+1]
+	slot := float64(htmlChartW) / float64(len(buckets))
+	plot := float64(htmlChartH - 2*htmlChartMargin)
+	for i, b := range buckets {
+		h := plot * float64(b.Count) / float64(peak)
+		p.Bars = append(p.Bars, htmlBar{
+			X: float64(i)*slot + slot*0.1, W: slot * 0.8,
+			Y: htmlChartMargin + plot - h, H: h,
+			Label: "≤ " + b.bucketLabel(), Count: b.Count,
+		})
+	}
+	return p
+}
+
+// Close 写出整个页面并删除临时文件，WriteResult 出错之后也要调用，否则临时文件会留在 $TMPDIR 中
+func (h *htmlWriter) Close(s Summary) error {
+	for _, f := range []*os.File{h.rows, h.failures} {
+		if f != nil {
+			defer os.Remove(f.Name())
+			defer f.Close()
+		}
+	}
+	page := newHTMLPage(s)
+	if err := htmlTemplate.ExecuteTemplate(h.out, "head", page); err != nil {
+		return err
+	}
+	if err := copyFrom(h.out, h.rows); err != nil {
+		return err
+	}
+	if err := htmlTemplate.ExecuteTemplate(h.out, "middle", page); err != nil {
+		return err
+	}
+	if err := copyFrom(h.out, h.failures); err != nil {
+		return err
+	}
+	return htmlTemplate.ExecuteTemplate(h.out, "foot", page)
+}
+
+// copyFrom 把临时文件从头复制到 out，f 为 nil 时什么都不做
+func copyFrom(out io.Writer, f *os.File) error {
+	if f == nil {
+		return nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(out, f)
+	return err
+}
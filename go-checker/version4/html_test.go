@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestHTMLWriter(t *testing.T) {
+	results := append(sampleResults(), checker.Result{
+		URL: "https://c.com/<script>alert(1)</script>", Kind: "http", StatusCode: 503, Latency: 80 * time.Millisecond,
+		Failures: []string{"状态码 503 不在期望范围 [200-399] 内"},
+		Timing:   &checker.PhaseTiming{DNS: 10 * time.Millisecond, Connect: 20 * time.Millisecond, TTFB: 40 * time.Millisecond, Download: 10 * time.Millisecond},
+	})
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	var buf bytes.Buffer
+	w := newHTMLWriter(&buf)
+	for _, res := range results {
+		if err := w.WriteResult(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(summarize(results)); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("期望 Close 之后删除临时文件, 但还有 %d 个", len(entries))
+	}
+
+	for _, want := range []string{
+		`<div class="value">4</div><div class="label">目标</div>`,
+		`<svg viewBox="0 0 720 220"`,
+		`<td class="url">https://a.com</td>`,
+		`<a href="#f-2">断言失败: 状态码 500 不在期望范围 [200-399] 内</a>`,
+		`<details id="f-4">`,
+		"https://c.com/&lt;script&gt;alert(1)&lt;/script&gt;",
+		`<dt>TTFB</dt><dd>40.0 ms</dd>`,
+		`width="50.000" height="6" fill="#f6b26b"`,
+		"</html>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("期望 HTML 中有 %q", want)
+		}
+	}
+	if strings.Contains(page, "<script>alert(1)") {
+		t.Error("期望 URL 中的 <script> 被转义")
+	}
+	if strings.Contains(page, "ZgotmplZ") {
+		t.Error("期望模板中没有被 html/template 拒绝的值")
+	}
+	if strings.Count(page, "<details") != 3 {
+		t.Errorf("期望 3 个失败详情, 但得到了 %d 个", strings.Count(page, "<details"))
+	}
+}
+
+func TestTeeWriter(t *testing.T) {
+	a, b := &recordWriter{}, &recordWriter{}
+	w := teeWriter{a, b}
+	for _, res := range sampleResults() {
+		if err := w.WriteResult(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(Summary{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.names) != 3 || len(b.names) != 3 || !a.closed || !b.closed {
+		t.Errorf("期望每个 ReportWriter 都收到 3 个结果并被关闭, 但得到了 %+v 和 %+v", a, b)
+	}
+}
+
+func TestHTMLWriterTempError(t *testing.T) {
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	var buf bytes.Buffer
+	w := newHTMLWriter(&buf)
+	if err := w.WriteResult(sampleResults()[0]); err == nil {
+		t.Fatal("期望临时目录不存在时返回错误")
+	}
+	// 出错之后仍然可以 Close，输出一个没有结果的页面
+	if err := w.Close(Summary{}); err != nil || !strings.Contains(buf.String(), "</html>") {
+		t.Errorf("期望出错之后 Close 仍然写出页面, 但得到了 %v", err)
+	}
+}
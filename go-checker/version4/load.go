@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// LoadPlan 描述压测的速率：从 RPS 开始，在 Duration 内线性变化到 RampTo，RampTo 为 nil 时保持 RPS 不变。
+// RampTo 用指针是因为 0 也是有意义的值：可以从 RPS 逐渐降到 0
+type LoadPlan struct {
+	RPS      float64
+	RampTo   *float64
+	Duration time.Duration
+}
+
+func (p LoadPlan) validate() error {
+	switch {
+	case p.Duration <= 0:
+		return errors.New("压测时长必须大于 0")
+	case p.RPS < 0 || p.endRate() < 0:
+		return errors.New("请求速率不能为负数")
+	case p.RPS == 0 && p.endRate() == 0:
+		return errors.New("请求速率必须大于 0")
+	}
+	return nil
+}
+
+func (p LoadPlan) endRate() float64 {
+	if p.RampTo != nil {
+		return *p.RampTo
+	}
+	return p.RPS
+}
+
+// rate 返回开始之后 at 时刻的目标速率，压测结束之后为 0
+func (p LoadPlan) rate(at time.Duration) float64 {
+	if at < 0 || at >= p.Duration {
+		return 0
+	}
+	return p.RPS + (p.endRate()-p.RPS)*at.Seconds()/p.Duration.Seconds()
+}
+
+// total 是整个压测按计划要发出的请求数，也就是速率曲线下的面积
+func (p LoadPlan) total() int {
+	return int((p.RPS + p.endRate()) / 2 * p.Duration.Seconds())
+}
+
+// offset 返回第 i 个请求（从 0 开始）按计划应该在开始之后多久发出。
+// 速率 r(t) = r0 + k·t，到 t 时刻为止应发出 n(t) = r0·t + k·t²/2 个请求，
+// 解这个方程得到 t = 2n / (r0 + √(r0² + 2kn))，这种写法在 k 为 0（匀速）时也成立。
+func (p LoadPlan) offset(i int) time.Duration {
+	if i == 0 {
+		return 0
+	}
+	n := float64(i)
+	k := (p.endRate() - p.RPS) / p.Duration.Seconds()
+	t := 2 * n / (p.RPS + math.Sqrt(max(p.RPS*p.RPS+2*k*n, 0)))
+	return time.Duration(t * float64(time.Second))
+}
+
+// loadSample 是压测中一个请求的结果
+type loadSample struct {
+	Offset    time.Duration // 按计划应该发出的时间，相对于压测开始
+	Latency   time.Duration // 从真正发出到完成，即服务时间
+	Corrected time.Duration // 从计划发出的时间到完成，包括因为发送不及时而等待的时间
+	Done      time.Duration // 完成的时间，相对于压测开始
+	OK        bool
+	Category  string // 失败时的错误类别
+}
+
+// LoadTester 按照固定或线性变化的速率向一个目标发送请求。
+// 知识点：这是“开放模型”，请求按时间表发出，不等上一个请求完成。
+// 如果像 worker 池那样等请求完成才发下一个（封闭模型），服务变慢时发出的请求也跟着变少，
+// 慢的那段时间几乎没有样本，测出的延迟会比真实情况好很多，这就是 coordinated omission。
+type LoadTester struct {
+	Target      checker.Target
+	Plan        LoadPlan
+	MaxInFlight int          // 同时进行中的请求上限，0 表示不限制；到达上限时后面的请求会晚发，校正后的延迟会体现出来
+	Client      *http.Client // HTTP 请求使用的客户端，为 nil 时使用 checker 包共享的连接池
+}
+
+// Run 执行压测，直到按计划发完所有请求并等它们完成，或者 ctx 被取消。
+// 每个请求完成后把样本交给 onSample，onSample 不会被并发调用
+func (l *LoadTester) Run(ctx context.Context, onSample func(loadSample)) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	var slots chan struct{}
+	if l.MaxInFlight > 0 {
+		slots = make(chan struct{}, l.MaxInFlight)
+	}
+
+	check := checker.Options{Client: l.Client}.Check
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+send:
+	for i := range l.Plan.total() {
+		offset := l.Plan.offset(i)
+		// 落后于计划时不等待，立即发出，保持整体速率
+		if wait := time.Until(start.Add(offset)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				break send
+			}
+		}
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				break send
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			begin := time.Now()
+			res := check(ctx, l.Target)
+			end := time.Now()
+			if slots != nil {
+				<-slots
+			}
+			s := loadSample{Offset: offset, Latency: end.Sub(begin), Corrected: end.Sub(start.Add(offset)), Done: end.Sub(start), OK: res.OK()}
+			if !s.OK {
+				s.Category = res.Category()
+			}
+			mu.Lock()
+			onSample(s)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// LoadBucket 是压测报告中的一个时间段。请求按计划发出的时间归类，
+// Completed 则按完成的时间统计，用来计算这段时间的吞吐量。
+type LoadBucket struct {
+	Start     time.Duration
+	TargetRPS float64 // 时间段中间的目标速率
+	Sent      int
+	Completed int
+	Errors    int
+	Latency   LatencyStats // 只统计成功的请求，下同
+	Corrected LatencyStats
+}
+
+// LoadReport 是一次压测的结果
+type LoadReport struct {
+	URL       string
+	Plan      LoadPlan
+	Bucket    time.Duration // 每个时间段的长度
+	Elapsed   time.Duration // 从开始到最后一个请求完成
+	Sent      int
+	Errors    int
+	Canceled  int            // 因为 Ctrl-C 或 -deadline 没有完成的请求，不计入错误
+	ByError   map[string]int // 按错误类别统计
+	Latency   LatencyStats
+	Corrected LatencyStats
+	Buckets   []LoadBucket
+}
+
+// Throughput 是每秒完成的请求数，包括失败的请求
+func (r LoadReport) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Sent-r.Canceled) / r.Elapsed.Seconds()
+}
+
+// ErrorRate 是失败请求的比例，被取消的请求不参与计算
+func (r LoadReport) ErrorRate() float64 {
+	if done := r.Sent - r.Canceled; done > 0 {
+		return float64(r.Errors) / float64(done)
+	}
+	return 0
+}
+
+// loadCollector 边压测边汇总样本：每个样本只更新计数和 LatencyRecorder，不保存下来，
+// 内存只和时间段的数量有关，和请求数无关，长时间、高速率的压测也不会占用越来越多的内存
+type loadCollector struct {
+	r                  LoadReport
+	end                time.Duration     // 最后一个请求完成的时间，不早于计划的结束时间
+	latency, corrected []LatencyRecorder // 每个时间段一个
+	allLatency         LatencyRecorder
+	allCorrected       LatencyRecorder
+}
+
+// newLoadCollector 返回一个空的汇总，bucket 是报告中每个时间段的长度
+func newLoadCollector(url string, plan LoadPlan, bucket time.Duration) *loadCollector {
+	return &loadCollector{r: LoadReport{URL: url, Plan: plan, Bucket: bucket, ByError: make(map[string]int)}, end: plan.Duration}
+}
+
+// grow 保证第 i 个时间段存在
+func (c *loadCollector) grow(i int) {
+	for len(c.r.Buckets) <= i {
+		start := time.Duration(len(c.r.Buckets)) * c.r.Bucket
+		c.r.Buckets = append(c.r.Buckets, LoadBucket{Start: start, TargetRPS: c.r.Plan.rate(start + c.r.Bucket/2)})
+		c.latency = append(c.latency, LatencyRecorder{})
+		c.corrected = append(c.corrected, LatencyRecorder{})
+	}
+}
+
+// Add 汇总一个样本
+func (c *loadCollector) Add(s loadSample) {
+	i := int(s.Offset / c.r.Bucket)
+	c.grow(i)
+	c.r.Sent++
+	c.r.Buckets[i].Sent++
+	c.end = max(c.end, s.Done)
+	switch {
+	case s.Category == checker.CategoryCanceled:
+		c.r.Canceled++
+		return
+	case !s.OK:
+		c.r.Errors++
+		c.r.ByError[s.Category]++
+		c.r.Buckets[i].Errors++
+	default:
+		c.latency[i].Add(s.Latency)
+		c.corrected[i].Add(s.Corrected)
+		c.allLatency.Add(s.Latency)
+		c.allCorrected.Add(s.Corrected)
+	}
+	done := int(s.Done / c.r.Bucket)
+	c.grow(done)
+	c.r.Buckets[done].Completed++
+}
+
+// Report 返回汇总的报告，elapsed 是从开始到最后一个请求完成的时间
+func (c *loadCollector) Report(elapsed time.Duration) LoadReport {
+	// 最后发出的请求可能在计划结束之后才完成，时间段要覆盖到最后一个请求完成。
+	// 正好在时间段边界上完成的请求算在前一个时间段，不为它多出一个时间段
+	n := int(math.Ceil(float64(c.end) / float64(c.r.Bucket)))
+	c.grow(n - 1)
+	r := c.r
+	r.Elapsed = elapsed
+	r.Buckets = slices.Clone(c.r.Buckets[:n])
+	for _, b := range c.r.Buckets[n:] {
+		r.Buckets[n-1].Completed += b.Completed
+	}
+	for i := range r.Buckets {
+		r.Buckets[i].Latency = c.latency[i].Stats()
+		r.Buckets[i].Corrected = c.corrected[i].Stats()
+	}
+	r.Latency = c.allLatency.Stats()
+	r.Corrected = c.allCorrected.Stats()
+	return r
+}
+
+// printLoadReport 以文本格式输出压测报告
+func printLoadReport(out io.Writer, r LoadReport) error {
+	fmt.Fprintf(out, "压测 %s: %s\n\n", r.URL, planText(r.Plan))
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	fmt.Fprintln(w, "Time\tTarget RPS\tSent\tThroughput\tErrors\tP50\tP90\tP99\tCorrected P99\t")
+	for _, b := range r.Buckets {
+		fmt.Fprintf(w, "%v\t%.1f\t%d\t%.1f/s\t%d\t%v\t%v\t%v\t%v\t\n", b.Start, b.TargetRPS, b.Sent, float64(b.Completed)/r.Bucket.Seconds(), b.Errors,
+			b.Latency.P50, b.Latency.P90, b.Latency.P99, b.Corrected.P99)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "\n--- 统计信息 ---")
+	fmt.Fprintf(out, "发出请求: %d\n", r.Sent)
+	fmt.Fprintf(out, "吞吐量: %.1f 请求/秒\n", r.Throughput())
+	fmt.Fprintf(out, "错误率: %.2f%%\n", r.ErrorRate()*100)
+	for _, category := range slices.Sorted(maps.Keys(r.ByError)) {
+		fmt.Fprintf(out, "  %s: %d\n", category, r.ByError[category])
+	}
+	if r.Canceled > 0 {
+		fmt.Fprintf(out, "已取消: %d（报告不完整）\n", r.Canceled)
+	}
+	if r.Latency.Count > 0 {
+		l, c := r.Latency, r.Corrected
+		fmt.Fprintf(out, "延迟 P50/P90/P99/最大: %v / %v / %v / %v\n", l.P50, l.P90, l.P99, l.Max)
+		fmt.Fprintf(out, "校正后 P50/P90/P99/最大: %v / %v / %v / %v\n", c.P50, c.P90, c.P99, c.Max)
+	}
+	_, err := fmt.Fprintln(out, "-----------------")
+	return err
+}
+
+func planText(p LoadPlan) string {
+	if p.endRate() != p.RPS {
+		return fmt.Sprintf("%g → %g 请求/秒，持续 %v", p.RPS, p.endRate(), p.Duration)
+	}
+	return fmt.Sprintf("%g 请求/秒，持续 %v", p.RPS, p.Duration)
+}
+
+// loadRecord 是压测报告在 JSON 中的样子，时间单位都是毫秒
+type loadRecord struct {
+	URL        string             `json:"url"`
+	RPS        float64            `json:"rps"`
+	RampTo     *float64           `json:"ramp_to,omitempty"`
+	DurationMS float64            `json:"duration_ms"`
+	BucketMS   float64            `json:"bucket_ms"`
+	ElapsedMS  float64            `json:"elapsed_ms"`
+	Sent       int                `json:"sent"`
+	Errors     int                `json:"errors"`
+	Canceled   int                `json:"canceled,omitempty"`
+	ByError    map[string]int     `json:"errors_by_category,omitempty"`
+	Throughput float64            `json:"throughput"`
+	ErrorRate  float64            `json:"error_rate"`
+	Latency    *latencyRecord     `json:"latency,omitempty"`
+	Corrected  *latencyRecord     `json:"corrected_latency,omitempty"`
+	Buckets    []loadBucketRecord `json:"buckets"`
+}
+
+type loadBucketRecord struct {
+	StartMS   float64        `json:"start_ms"`
+	TargetRPS float64        `json:"target_rps"`
+	Sent      int            `json:"sent"`
+	Completed int            `json:"completed"`
+	Errors    int            `json:"errors"`
+	Latency   *latencyRecord `json:"latency,omitempty"`
+	Corrected *latencyRecord `json:"corrected_latency,omitempty"`
+}
+
+// writeLoadJSON 以 JSON 格式输出压测报告
+func writeLoadJSON(out io.Writer, r LoadReport) error {
+	rec := loadRecord{
+		URL:        r.URL,
+		RPS:        r.Plan.RPS,
+		RampTo:     r.Plan.RampTo,
+		DurationMS: milliseconds(r.Plan.Duration),
+		BucketMS:   milliseconds(r.Bucket),
+		ElapsedMS:  milliseconds(r.Elapsed),
+		Sent:       r.Sent,
+		Errors:     r.Errors,
+		Canceled:   r.Canceled,
+		ByError:    r.ByError,
+		Throughput: r.Throughput(),
+		ErrorRate:  r.ErrorRate(),
+		Latency:    newLatencyRecord(r.Latency),
+		Corrected:  newLatencyRecord(r.Corrected),
+		Buckets:    make([]loadBucketRecord, 0, len(r.Buckets)),
+	}
+	for _, b := range r.Buckets {
+		rec.Buckets = append(rec.Buckets, loadBucketRecord{
+			StartMS:   milliseconds(b.Start),
+			TargetRPS: b.TargetRPS,
+			Sent:      b.Sent,
+			Completed: b.Completed,
+			Errors:    b.Errors,
+			Latency:   newLatencyRecord(b.Latency),
+			Corrected: newLatencyRecord(b.Corrected),
+		})
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rec)
+}
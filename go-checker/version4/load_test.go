@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// rampTo 返回 LoadPlan.RampTo 需要的指针
+func rampTo(rps float64) *float64 {
+	return &rps
+}
+
+// buildLoadReport 汇总一组样本，和压测时一样经过 loadCollector
+func buildLoadReport(url string, plan LoadPlan, bucket, elapsed time.Duration, samples []loadSample) LoadReport {
+	c := newLoadCollector(url, plan, bucket)
+	for _, s := range samples {
+		c.Add(s)
+	}
+	return c.Report(elapsed)
+}
+
+// runLoadTester 执行压测并返回所有样本
+func runLoadTester(ctx context.Context, l *LoadTester) []loadSample {
+	var samples []loadSample
+	l.Run(ctx, func(s loadSample) { samples = append(samples, s) })
+	return samples
+}
+
+func TestLoadPlanOffset(t *testing.T) {
+	tests := []struct {
+		name  string
+		plan  LoadPlan
+		total int
+	}{
+		{"匀速", LoadPlan{RPS: 10, Duration: 2 * time.Second}, 20},
+		{"加速", LoadPlan{RPS: 10, RampTo: rampTo(30), Duration: 2 * time.Second}, 40},
+		{"减速", LoadPlan{RPS: 30, RampTo: rampTo(10), Duration: 2 * time.Second}, 40},
+		{"从 0 开始", LoadPlan{RPS: 0, RampTo: rampTo(20), Duration: 2 * time.Second}, 20},
+		{"降到 0", LoadPlan{RPS: 20, RampTo: rampTo(0), Duration: 2 * time.Second}, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.plan.total(); got != tt.total {
+				t.Fatalf("期望一共 %d 个请求, 但得到了 %d", tt.total, got)
+			}
+			prev := time.Duration(-1)
+			for i := range tt.total {
+				off := tt.plan.offset(i)
+				if off <= prev || off >= tt.plan.Duration {
+					t.Fatalf("第 %d 个请求的时间 %v 不对, 上一个是 %v", i, off, prev)
+				}
+				prev = off
+			}
+			// 按计划，第 total 个请求正好落在结束的时刻
+			if end := tt.plan.offset(tt.total); end < tt.plan.Duration-time.Millisecond || end > tt.plan.Duration+time.Millisecond {
+				t.Errorf("期望第 %d 个请求在 %v, 但得到了 %v", tt.total, tt.plan.Duration, end)
+			}
+		})
+	}
+
+	// 匀速时间隔相等
+	plan := LoadPlan{RPS: 4, Duration: time.Second}
+	for i, want := range []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond} {
+		if got := plan.offset(i); got != want {
+			t.Errorf("第 %d 个请求: 期望 %v, 但得到了 %v", i, want, got)
+		}
+	}
+	// 加速时后半段更密集
+	ramp := LoadPlan{RPS: 10, RampTo: rampTo(30), Duration: 2 * time.Second}
+	if first, last := ramp.offset(1)-ramp.offset(0), ramp.offset(39)-ramp.offset(38); first <= last {
+		t.Errorf("期望加速时间隔越来越小, 但开始是 %v, 最后是 %v", first, last)
+	}
+}
+
+func TestLoadPlanValidate(t *testing.T) {
+	invalid := []LoadPlan{
+		{RPS: 10},
+		{RPS: 0, Duration: time.Second},
+		{RPS: -1, Duration: time.Second},
+		{RPS: 10, RampTo: rampTo(-5), Duration: time.Second},
+		{RPS: 0, RampTo: rampTo(0), Duration: time.Second},
+	}
+	for _, p := range invalid {
+		if err := p.validate(); err == nil {
+			t.Errorf("%+v: 期望返回错误, 但没有", p)
+		}
+	}
+	if err := (LoadPlan{RPS: 0, RampTo: rampTo(10), Duration: time.Second}).validate(); err != nil {
+		t.Errorf("期望可以从 0 开始加速, 但得到了 %v", err)
+	}
+	if err := (LoadPlan{RPS: 10, RampTo: rampTo(0), Duration: time.Second}).validate(); err != nil {
+		t.Errorf("期望可以逐渐降到 0, 但得到了 %v", err)
+	}
+}
+
+func TestBuildLoadReport(t *testing.T) {
+	ms := time.Millisecond
+	samples := []loadSample{
+		{Offset: 0, Latency: 10 * ms, Corrected: 10 * ms, Done: 10 * ms, OK: true},
+		{Offset: 500 * ms, Latency: 20 * ms, Corrected: 30 * ms, Done: 530 * ms, OK: true},
+		{Offset: 1000 * ms, Latency: 40 * ms, Corrected: 40 * ms, Done: 1040 * ms, OK: false, Category: checker.CategoryTimeout},
+		{Offset: 1500 * ms, Latency: 600 * ms, Corrected: 700 * ms, Done: 2200 * ms, OK: true},
+		{Offset: 1900 * ms, Latency: 5 * ms, Corrected: 5 * ms, Done: 1905 * ms, OK: false, Category: checker.CategoryCanceled},
+	}
+	plan := LoadPlan{RPS: 2, Duration: 2 * time.Second}
+	r := buildLoadReport("http://example.com", plan, time.Second, 2200*ms, samples)
+
+	if r.Sent != 5 || r.Errors != 1 || r.Canceled != 1 || r.ByError[checker.CategoryTimeout] != 1 {
+		t.Errorf("统计错误: %+v", r)
+	}
+	if got := r.ErrorRate(); got != 0.25 {
+		t.Errorf("期望错误率 0.25, 但得到了 %v", got)
+	}
+	if got := r.Throughput(); got < 1.81 || got > 1.82 {
+		t.Errorf("期望吞吐量 4/2.2s, 但得到了 %v", got)
+	}
+	if r.Latency.Count != 3 || r.Latency.Max != 600*ms || r.Corrected.Max != 700*ms {
+		t.Errorf("延迟统计错误: %+v / %+v", r.Latency, r.Corrected)
+	}
+
+	// 最后一个请求在 2.2s 完成，时间段要延长到第 3 秒
+	if len(r.Buckets) != 3 {
+		t.Fatalf("期望 3 个时间段, 但得到了 %d", len(r.Buckets))
+	}
+	want := []struct {
+		sent, completed, errors int
+		targetRPS               float64
+	}{{2, 2, 0, 2}, {3, 1, 1, 2}, {0, 1, 0, 0}}
+	for i, w := range want {
+		b := r.Buckets[i]
+		if b.Sent != w.sent || b.Completed != w.completed || b.Errors != w.errors || b.TargetRPS != w.targetRPS {
+			t.Errorf("第 %d 个时间段: 期望 %+v, 但得到了 %+v", i, w, b)
+		}
+	}
+
+	// 正好在时间段边界上完成的请求算在前一个时间段
+	edge := buildLoadReport("http://example.com", plan, time.Second, 2*time.Second, []loadSample{{Offset: 1500 * ms, Done: 2000 * ms, OK: true}})
+	if len(edge.Buckets) != 2 || edge.Buckets[1].Completed != 1 {
+		t.Errorf("期望 2 个时间段, 请求算在最后一个, 但得到了 %+v", edge.Buckets)
+	}
+
+	var text bytes.Buffer
+	if err := printLoadReport(&text, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"错误率: 25.00%", "timeout: 1", "已取消: 1"} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("文本报告中缺少 %q:\n%s", s, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeLoadJSON(&out, r); err != nil {
+		t.Fatal(err)
+	}
+	var rec loadRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Sent != 5 || len(rec.Buckets) != 3 || rec.Corrected == nil || rec.Corrected.MaxMS != 700 {
+		t.Errorf("JSON 报告错误: %s", out.String())
+	}
+}
+
+func TestLoadTesterRate(t *testing.T) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	plan := LoadPlan{RPS: 100, Duration: 300 * time.Millisecond}
+	start := time.Now()
+	samples := runLoadTester(context.Background(), &LoadTester{Target: checker.Target{URL: server.URL}, Plan: plan})
+	elapsed := time.Since(start)
+
+	if len(samples) != 30 || hits.Load() != 30 {
+		t.Errorf("期望发出 30 个请求, 但得到了 %d 个样本, 服务器收到 %d 个", len(samples), hits.Load())
+	}
+	if elapsed < 290*time.Millisecond {
+		t.Errorf("期望按速率在大约 300ms 内发完, 但只用了 %v", elapsed)
+	}
+	for _, s := range samples {
+		if !s.OK {
+			t.Errorf("期望请求成功, 但得到了 %+v", s)
+		}
+	}
+}
+
+// 服务器每个请求需要 50ms，而且同时只能有一个请求在进行。按 100 请求/秒发送时，
+// 只看服务时间每个请求都是 50ms 左右，但后面的请求其实已经排队等了很久。
+func TestLoadTesterCoordinatedOmission(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	plan := LoadPlan{RPS: 100, Duration: 100 * time.Millisecond}
+	samples := runLoadTester(context.Background(), &LoadTester{Target: checker.Target{URL: server.URL}, Plan: plan, MaxInFlight: 1})
+	r := buildLoadReport(server.URL, plan, 50*time.Millisecond, 0, samples)
+
+	if r.Latency.Count != 10 {
+		t.Fatalf("期望 10 个成功的请求, 但得到了 %+v", r)
+	}
+	if r.Latency.P99 > 200*time.Millisecond {
+		t.Errorf("期望服务时间在 50ms 左右, 但 P99 是 %v", r.Latency.P99)
+	}
+	// 最后一个请求计划在 90ms 发出，要等前面 9 个请求完成，至少在 500ms 时才完成
+	if r.Corrected.Max < 400*time.Millisecond {
+		t.Errorf("期望校正后的延迟包含排队时间, 但最大只有 %v", r.Corrected.Max)
+	}
+}
+
+func TestLoadTesterCanceled(t *testing.T) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	samples := runLoadTester(ctx, &LoadTester{Target: checker.Target{URL: server.URL}, Plan: LoadPlan{RPS: 50, Duration: 10 * time.Second}})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("期望取消后很快返回, 但用了 %v", elapsed)
+	}
+	if len(samples) == 0 || len(samples) > 10 {
+		t.Errorf("期望取消前只发出了少量请求, 但得到了 %d 个", len(samples))
+	}
+}
@@ -1,120 +1,686 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"text/tabwriter"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"go-learning/go-checker/version4/checker"
 )
 
-type CheckResult struct {
-	URL        string
-	StatusCode int
-	Latency    time.Duration
-	Error      error
+// progress 是 worker 打印处理进度的地方。输出 JSON 等机器可读格式时
+// 改为写到标准错误，避免和标准输出上的报告混在一起。
+var progress io.Writer = os.Stdout
+
+// verbose 对应 -v 参数，文本报告中会额外输出重定向链等详细信息
+var verbose bool
+
+// streamOutput 对应 -stream 参数，文本表格每拿到一个结果就输出一行，不再攒够一块再对齐输出
+var streamOutput bool
+
+// runOptions 返回 worker 池的参数，每个 worker 开始处理一个目标时打印进度。
+// 所有 HTTP 检查共用 client，这样同一个主机的连接可以在检查之间复用。
+// adaptive 不为 nil 时 concurrency 只是初始的并发数；hostLimit 是没有单独配置的目标所在主机的限制。
+func runOptions(concurrency int, client *http.Client, adaptive *checker.AdaptivePolicy, hostLimit *checker.HostLimit, breaker *checker.BreakerPolicy) checker.Options {
+	return checker.Options{
+		Concurrency: concurrency,
+		Client:      client,
+		Adaptive:    adaptive,
+		HostLimit:   hostLimit,
+		Breaker:     breaker,
+		OnStart: func(worker int, t checker.Target) {
+			fmt.Fprintf(progress, "Worker %d 开始处理 %s\n", worker, t.URL)
+		},
+	}
+}
+
+// errDeadline 是超过 -deadline 时取消检查的原因
+var errDeadline = errors.New("超过了 -deadline 限制的总时长")
+
+// errDashboardQuit 是在仪表盘中按 q 时取消检查的原因
+var errDashboardQuit = errors.New("在仪表盘中按了 q")
+
+// copyReport 把 -tui 时写到临时文件的报告输出到 out，然后删除临时文件
+func copyReport(out io.Writer, f *os.File) error {
+	defer os.Remove(f.Name())
+	defer f.Close()
+	return copyFrom(out, f)
+}
+
+// feedTargets 把 stream 中的目标逐个交给 each 处理后发送到 jobs，读完之后关闭 jobs。
+// 被取消之后也要读完剩下的目标：RunStream 不会再检查它们，而是直接返回被取消的结果，
+// 这样没来得及检查的目标也会出现在报告中，标记为已取消。从一直不结束的标准输入读取时，再按一次 Ctrl-C 强制退出
+func feedTargets(stream targetStream, jobs chan<- checker.Target, each func(*checker.Target)) error {
+	defer close(jobs)
+	return stream(func(t checker.Target) bool {
+		each(&t)
+		jobs <- t
+		return true
+	})
+}
+
+// signalDashboard 是打开着的仪表盘，收到信号时用来推迟提示、在强制退出之前恢复终端
+var signalDashboard atomic.Pointer[dashboard]
+
+// notifyContext 返回一个在收到 SIGINT、SIGTERM 时被取消的 context，取消原因里带有信号名。
+// 如果还没退出，再按一次 Ctrl-C 就会强制结束：os.Exit 不会执行 defer，所以先恢复仪表盘占用的终端。
+func notifyContext() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		msg := fmt.Sprintf("收到信号 %v，正在停止（再按一次 Ctrl-C 强制退出）", sig)
+		// 仪表盘打开时日志会混在画面里，等它关闭之后再打印
+		if !signalDashboard.Load().notice(msg) {
+			log.Print(msg)
+		}
+		cancel(fmt.Errorf("收到信号 %v", sig))
+
+		sig = <-sigs
+		if d := signalDashboard.Load(); d != nil {
+			d.restoreTerminal()
+			log.SetOutput(os.Stderr)
+		}
+		log.Printf("再次收到信号 %v，强制退出", sig)
+		os.Exit(128 + int(sig.(syscall.Signal))) // 和被信号直接结束时 shell 看到的退出码一样
+	}()
+	return ctx
+}
+
+// stringList 实现了 flag.Value 接口，让一个参数可以重复出现多次
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ", ") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
 }
 
-func checkURL(url string) CheckResult {
-	client := http.Client{
-		Timeout: 5 * time.Second, // 设置一个5秒的超时，非常重要！
+// buildAssertions 把命令行上的断言参数组装成 Assertions，没有任何断言时返回 nil
+func buildAssertions(status, body, bodyRegex, finalURL string, headers, jsonPaths stringList) (*checker.Assertions, error) {
+	if status == "" && body == "" && bodyRegex == "" && finalURL == "" && len(headers) == 0 && len(jsonPaths) == 0 {
+		return nil, nil
 	}
-	start := time.Now()
-	resp, err := client.Get(url)
-	latency := time.Since(start)
+	c := &assertConfig{Status: status, Body: body, BodyRegex: bodyRegex, FinalURL: finalURL}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("响应头断言应为 \"名称: 值\" 格式: %q", h)
+		}
+		if c.Headers == nil {
+			c.Headers = make(map[string]string)
+		}
+		c.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	for _, j := range jsonPaths {
+		path, value, ok := strings.Cut(j, "=")
+		if !ok {
+			return nil, fmt.Errorf("JSON 断言应为 \"路径=值\" 格式: %q", j)
+		}
+		if c.JSON == nil {
+			c.JSON = make(map[string]any)
+		}
+		c.JSON[strings.TrimSpace(path)] = checker.ParseJSONValue(strings.TrimSpace(value))
+	}
+	return c.build()
+}
 
-	if err != nil {
-		return CheckResult{URL: url, Error: err}
+// buildRetryPolicy 把命令行上的重试参数组装成 RetryPolicy，不重试时返回 nil
+func buildRetryPolicy(retries int, base, max time.Duration, jitter float64, on, status string) (*checker.RetryPolicy, error) {
+	if retries <= 0 {
+		return nil, nil
 	}
-	defer resp.Body.Close()
+	c := &retryConfig{
+		Attempts:  retries + 1,
+		BaseDelay: base.String(),
+		MaxDelay:  max.String(),
+		Jitter:    jitter,
+		On:        strings.Split(on, ","),
+		Status:    &status,
+	}
+	return c.build()
+}
+
+// 单次运行结束时的退出码，方便在脚本和 CI 中判断结果。
+// 参数错误等情况由 log.Fatal 退出，退出码同样是 1。
+const (
+	exitOK   = 0 // 全部成功
+	exitFail = 1 // 至少有一个目标失败
+	exitWarn = 2 // 没有失败，但至少有一个目标带有警告
+)
 
-	return CheckResult{URL: url, StatusCode: resp.StatusCode, Latency: latency}
+// exitCode 根据统计信息得出退出码，失败优先于警告
+func exitCode(s Summary) int {
+	switch {
+	case s.Fail > 0:
+		return exitFail
+	case s.Warn > 0:
+		return exitWarn
+	}
+	return exitOK
 }
 
-// worker 函数从 jobs channel 接收任务，并将结果发送到 results channel
-func worker(id int, jobs <-chan string, results chan<- CheckResult) {
-	for url := range jobs {
-		fmt.Printf("Worker %d 开始处理 %s\n", id, url)
-		result := checkURL(url)
-		results <- result
+// runSubcommand 执行 history、diff 子命令，args[0] 不是子命令时返回 false
+func runSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	var err error
+	switch args[0] {
+	case "history":
+		err = runHistory(args[1:], os.Stdout)
+	case "diff":
+		err = runDiff(args[1:], os.Stdout)
+	default:
+		return false
+	}
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errRegression):
+		os.Exit(exitFail)
+	case err != nil:
+		log.Fatal(err)
 	}
+	return true
+}
+
+// runLoad 执行压测模式并输出报告，返回退出码
+func runLoad(t checker.Target, plan LoadPlan, bucket time.Duration, maxInFlight int, maxErrorRate float64, output string, deadline time.Duration, client *http.Client) int {
+	if err := plan.validate(); err != nil {
+		log.Fatalf("压测参数错误: %v", err)
+	}
+	if bucket <= 0 {
+		log.Fatal("-load-bucket 必须大于 0")
+	}
+	if output != "text" && output != "json" {
+		log.Fatalf("压测模式只支持 text 和 json 输出, 但得到了 %q", output)
+	}
+	ctx := notifyContext()
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, deadline, errDeadline)
+		defer cancel()
+	}
+
+	fmt.Fprintf(progress, "开始压测 %s: %s\n", t.URL, planText(plan))
+	tester := &LoadTester{Target: t, Plan: plan, MaxInFlight: maxInFlight, Client: client}
+	start := time.Now()
+	collector := newLoadCollector(t.URL, plan, bucket)
+	tester.Run(ctx, collector.Add)
+	report := collector.Report(time.Since(start))
+
+	var err error
+	if output == "json" {
+		err = writeLoadJSON(os.Stdout, report)
+	} else {
+		err = printLoadReport(os.Stdout, report)
+	}
+	if err != nil {
+		log.Fatalf("输出报告失败: %v", err)
+	}
+	if report.ErrorRate() > maxErrorRate || report.Canceled > 0 {
+		return exitFail
+	}
+	return exitOK
 }
 
 // 把任务分发、工作、结果收集三块分开
 func main() {
+	// history 和 diff 子命令查询历史记录，其他情况是正常的检查
+	if runSubcommand(os.Args[1:]) {
+		return
+	}
+
 	// 1. 使用 flag 包接收命令行传入的文件名
-	filePath := flag.String("file", "urls.txt", "包含URL列表的文件路径")
-	concurrency := flag.Int("c", 10, "并发的 worker 数量")
+	filePath := flag.String("file", "urls.txt", "目标列表文件：.json 结尾的按配置文件解析，其他按每行一个URL解析，- 表示从标准输入读取")
+	concurrency := flag.Int("c", 10, "并发的 worker 数量，-adaptive 时是初始的数量")
+	adaptiveMode := flag.Bool("adaptive", false, "根据延迟、错误率和 worker 的忙碌程度在 -c-min 和 -c-max 之间自动调整并发数（加性增、乘性减）")
+	minConcurrency := flag.Int("c-min", 1, "-adaptive 时并发数的下限")
+	maxConcurrency := flag.Int("c-max", 100, "-adaptive 时并发数的上限")
+	expectStatus := flag.String("expect-status", "", "期望的状态码，如 200,301-302,2xx（默认 200-399）")
+	expectBody := flag.String("expect-body", "", "响应体必须包含的字符串")
+	expectBodyRegex := flag.String("expect-body-regex", "", "响应体必须匹配的正则")
+	var expectHeaders, expectJSON stringList
+	flag.Var(&expectHeaders, "expect-header", "必须出现的响应头，格式为 \"名称: 值\"，可重复")
+	flag.Var(&expectJSON, "expect-json", "JSON 路径断言，格式为 \"路径=值\"，如 data.status=ok，可重复")
+	watch := flag.Bool("watch", false, "持续监控模式：按间隔反复检查，并打印状态变化")
+	interval := flag.Duration("interval", time.Minute, "监控模式下默认的检查间隔")
+	window := flag.Int("window", 100, "监控模式下每个目标保留最近多少次延迟，用于计算分位数")
+	summaryEvery := flag.Duration("summary-every", 5*time.Minute, "监控模式下打印状态汇总的间隔，0 表示不打印")
+	output := flag.String("output", "text", "输出格式: text、json、ndjson、csv、junit")
+	metricsAddr := flag.String("metrics-addr", "", "监控模式下提供 Prometheus /metrics 接口的地址，如 :9100")
+	retries := flag.Int("retries", 0, "失败后最多重试的次数")
+	retryBase := flag.Duration("retry-base", 200*time.Millisecond, "第一次重试前的等待时间，之后每次翻倍")
+	retryMax := flag.Duration("retry-max", 5*time.Second, "重试等待时间的上限")
+	retryJitter := flag.Float64("retry-jitter", 0.2, "重试等待时间的随机抖动比例，0~1")
+	retryOn := flag.String("retry-on", strings.Join(checker.DefaultRetryOn, ","), "可以重试的错误类别: timeout,dns,connection_refused,tls,network,other")
+	retryStatus := flag.String("retry-status", "429,502-504", "可以重试的状态码")
+	metricsFile := flag.String("metrics-file", "", "把 Prometheus 指标写到这个文件，供 node_exporter 的 textfile collector 读取")
+	certWarnFlag := flag.String("cert-warn", "14d", "证书剩余有效期少于这个时间时给出警告，如 14d、72h，0 表示不检查")
+	insecure := flag.Bool("insecure", false, "跳过证书校验，但仍然检查证书的有效期和域名")
+	maxRedirects := flag.Int("max-redirects", checker.DefaultMaxRedirects, "最多跟随的重定向次数，0 表示不跟随，直接把 3xx 响应作为结果")
+	expectFinalURL := flag.String("expect-final-url", "", "跟随重定向之后期望的最终 URL")
+	flag.BoolVar(&verbose, "v", false, "文本报告中输出重定向链等详细信息")
+	var notifyWebhooks, notifyTo stringList
+	flag.Var(&notifyWebhooks, "notify-webhook", "状态变化时把通知 POST 到这个 URL，可重复")
+	notifyTemplate := flag.String("notify-webhook-template", "", "webhook 请求体的模板文件（text/template），默认发送 JSON 格式的事件")
+	notifySMTP := flag.String("notify-smtp", "", "发送邮件通知的 SMTP 服务器，如 smtp.example.com:587，密码从环境变量 GOCHECKER_SMTP_PASSWORD 读取")
+	notifySMTPUser := flag.String("notify-smtp-user", "", "SMTP 用户名，为空时不认证")
+	notifyFrom := flag.String("notify-from", "", "邮件通知的发件人")
+	flag.Var(&notifyTo, "notify-to", "邮件通知的收件人，可重复")
+	notifyExec := flag.String("notify-exec", "", "状态变化时执行的命令，事件 JSON 从标准输入传入")
+	renotify := flag.Duration("renotify", 0, "目标一直没有恢复时，每隔多久再提醒一次，0 表示不提醒")
+	historyFile := flag.String("history", "", "把每次检查的结果追加到这个文件，供 history、diff 子命令查询，如 "+defaultHistoryFile)
+	deadline := flag.Duration("deadline", 0, "整个运行的最长时间，超过后未完成的检查标记为已取消，0 表示不限制")
+	crawlRoot := flag.String("crawl", "", "爬取模式：从这个地址出发，检查站点页面上的所有链接，不再读取 -file")
+	crawlDepth := flag.Int("depth", 2, "爬取模式下最多跟随几层站内链接")
+	crawlExternal := flag.Bool("crawl-external", true, "爬取模式下是否检查外部链接（只检查一次，不会继续爬）")
+	loadURL := flag.String("load", "", "压测模式：按 -rps 的速率持续向这个地址发送请求，不再读取 -file")
+	loadRPS := flag.Float64("rps", 10, "压测模式下每秒发送的请求数")
+	loadRampTo := flag.Float64("ramp-to", -1, "压测模式下在 -duration 内把速率线性调整到这个值（可以是 0），负数表示保持 -rps 不变")
+	loadDuration := flag.Duration("duration", 30*time.Second, "压测持续的时间")
+	loadBucket := flag.Duration("load-bucket", time.Second, "压测报告中按多长的时间段统计延迟分位数")
+	maxInFlight := flag.Int("max-inflight", 1000, "压测模式下同时进行中的请求上限，0 表示不限制")
+	maxErrorRate := flag.Float64("max-error-rate", 0, "压测的错误率超过这个比例时退出码为 1，如 0.01")
+	freshConn := flag.Bool("fresh-conn", false, "不复用连接，每次检查都重新建立，测量包括 DNS、TCP 和 TLS 握手在内的冷启动延迟")
+	maxConnsPerHost := flag.Int("max-conns-per-host", 0, "每个主机同时打开的连接上限，0 表示不限制")
+	hostRPS := flag.Float64("host-rps", 0, "每个主机每秒最多开始几个检查，0 表示不限制")
+	hostBurst := flag.Int("host-burst", 1, "每个主机最多可以连续开始几个检查（令牌桶的容量），配合 -host-rps 使用")
+	hostConcurrency := flag.Int("host-concurrency", 0, "每个主机同时进行的检查上限，0 表示不限制。和 -max-conns-per-host 不同，超出的目标在队列中等待，不占用 worker")
+	breakerThreshold := flag.Int("breaker", 0, "一个主机连续这么多次连接失败（超时、连接被拒绝等）后熔断，剩下的目标直接跳过，0 表示不熔断")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "监控模式下熔断多久之后放一个检查过去试探主机是否恢复")
+	http2 := flag.Bool("http2", true, "HTTPS 目标支持时使用 HTTP/2，false 表示只使用 HTTP/1.1")
+	flag.BoolVar(&streamOutput, "stream", false, "文本表格每拿到一个结果就立即输出一行（列不再对齐），进度改为输出到标准错误")
+	order := flag.String("order", "completion", fmt.Sprintf("结果的输出顺序: completion（按完成的顺序）、input（按目标在列表中的顺序，最多暂存 %d 个先完成的结果，再多时暂停读取目标）", orderWindow))
+	sortBy := flag.String("sort", "", "收齐所有结果之后按这一列排序再输出: latency（慢的在前）、status（失败的在前）、name")
+	tui := flag.Bool("tui", false, "显示实时仪表盘：进度条、成功失败数、每个 worker 正在检查的目标、延迟走势和可以滚动的失败列表，结束后再输出报告。标准输出不是终端时退回普通输出")
+	htmlFile := flag.String("html", "", "另外把报告写成一个独立的 HTML 文件（内嵌样式和 SVG 图表），方便发给不看命令行的人")
 	flag.Parse() // 注意 flag.Parse() 只调用一次
 
-	// 2. 读取并解析文件
-	file, err := os.Open(*filePath)
+	if *watch && *output != "text" {
+		// 监控模式只打印状态变化和定期汇总，不会生成报告
+		log.Fatalf("-output %s 不能和 -watch 一起使用，监控模式的结果可以通过 -metrics-addr、-history 或通知获取", *output)
+	}
+	if streamOutput && *sortBy != "" {
+		log.Fatal("-sort 要等所有结果都到齐才能输出，不能和 -stream 一起使用")
+	}
+	// -tui 只在标准输出是终端时生效。仪表盘占着屏幕，报告先写到临时文件，仪表盘关闭之后再输出
+	useTUI := *tui && isTerminal(int(os.Stdout.Fd()))
+	if useTUI && (*watch || *loadURL != "") {
+		log.Fatal("-tui 只能用于单次检查和爬取模式")
+	}
+	if *htmlFile != "" && (*watch || *loadURL != "") {
+		log.Fatal("-html 只能用于单次检查和爬取模式")
+	}
+	// 先用 io.Discard 检查 -output、-order 和 -sort，报告要写的文件等到开始检查之前才创建
+	if w, err := newReportWriter(*output, io.Discard); err != nil {
+		log.Fatal(err)
+	} else if _, err := arrangeReport(w, *order, *sortBy); err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case useTUI:
+		progress = io.Discard // 进度显示在仪表盘上
+	case *output != "text" || streamOutput:
+		progress = os.Stderr
+	}
+
+	expect, err := buildAssertions(*expectStatus, *expectBody, *expectBodyRegex, *expectFinalURL, expectHeaders, expectJSON)
 	if err != nil {
-		log.Fatalf("无法打开文件: %v", err)
+		log.Fatalf("断言参数错误: %v", err)
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	var urls []string
-	for scanner.Scan() {
-		urls = append(urls, scanner.Text())
+	retry, err := buildRetryPolicy(*retries, *retryBase, *retryMax, *retryJitter, *retryOn, *retryStatus)
+	if err != nil {
+		log.Fatalf("重试参数错误: %v", err)
+	}
+
+	var redirect *checker.RedirectPolicy
+	if *maxRedirects != checker.DefaultMaxRedirects {
+		if *maxRedirects < 0 {
+			log.Fatalf("-max-redirects 不能为负数: %d", *maxRedirects)
+		}
+		redirect = &checker.RedirectPolicy{Follow: *maxRedirects > 0, MaxHops: *maxRedirects}
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("读取文件时发生错误: %v", err)
+
+	certWarn, err := checker.ParseCertWarn(*certWarnFlag)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// 创建任务 channel 和结果 channel
-	jobs := make(chan string, len(urls))
-	results := make(chan CheckResult, len(urls))
+	// 命令行上的断言、重试和重定向策略作为默认值，配置文件中自己写了的目标不受影响
+	defaults := checker.Target{Expect: expect, Retry: retry, Redirect: redirect, CertWarn: certWarn, Insecure: *insecure, FreshConn: *freshConn}
 
-	// 启动指定数量的 worker
-	for w := 1; w <= *concurrency; w++ {
-		go worker(w, jobs, results)
+	if *loadURL != "" {
+		// 压测的目标不使用重试，重试会掩盖真实的错误率
+		t := defaults
+		t.URL, t.Retry = *loadURL, nil
+		// 空闲连接池要能装下所有同时进行中的请求，否则请求完成后连接被关掉，后面的请求又要重新握手
+		idle := *maxInFlight
+		if idle <= 0 {
+			idle = 1000
+		}
+		client := &http.Client{Transport: checker.NewTransport(checker.TransportOptions{
+			MaxIdleConnsPerHost: idle, MaxIdleConns: idle, MaxConnsPerHost: *maxConnsPerHost, DisableHTTP2: !*http2})}
+		plan := LoadPlan{RPS: *loadRPS, Duration: *loadDuration}
+		if *loadRampTo >= 0 {
+			plan.RampTo = loadRampTo
+		}
+		os.Exit(runLoad(t, plan, *loadBucket, *maxInFlight, *maxErrorRate, *output, *deadline, client))
 	}
 
-	// 将所有 URL 发送到任务 channel
-	for _, url := range urls {
-		jobs <- url
+	// 2. 打开目标列表。爬取模式下目标是边爬边发现的；监控模式要反复检查，需要读出全部目标；
+	// 其他情况下目标边读边检查，列表再长也不会全部放进内存
+	var targets []checker.Target
+	var stream targetStream
+	var crawler *Crawler
+	switch {
+	case *crawlRoot != "":
+		if *watch {
+			log.Fatal("-crawl 不能和 -watch 一起使用")
+		}
+		if crawler, err = NewCrawler(*crawlRoot, *crawlDepth, *crawlExternal, defaults); err != nil {
+			log.Fatal(err)
+		}
+	case *watch:
+		if targets, err = loadTargets(*filePath, os.Stdin); err != nil {
+			log.Fatalf("读取目标列表失败: %v", err)
+		}
+		for i := range targets {
+			applyDefaults(&targets[i], defaults)
+		}
+	default:
+		if stream, err = openTargets(*filePath, os.Stdin); err != nil {
+			log.Fatalf("读取目标列表失败: %v", err)
+		}
 	}
-	close(jobs) // 发送完所有任务后，关闭 jobs channel
 
-	var allResults []CheckResult
-	// 收集所有结果
-	for a := 1; a <= len(urls); a++ {
-		result := <-results
-		allResults = append(allResults, result)
+	// -adaptive 时 worker 池在 -c-min 和 -c-max 之间伸缩，并发数的变化记在 timeline 中，最后输出到统计信息里
+	var adaptive *checker.AdaptivePolicy
+	var timeline concurrencyTimeline
+	workers := *concurrency
+	if *adaptiveMode {
+		if *minConcurrency < 1 || *maxConcurrency < *minConcurrency {
+			log.Fatal("-c-min 必须大于 0，并且不能大于 -c-max")
+		}
+		adaptive = &checker.AdaptivePolicy{Min: *minConcurrency, Max: *maxConcurrency, OnResize: timeline.add}
+		workers = *maxConcurrency
+	}
+
+	// 配置文件中单独写了 host_limit 的目标使用自己的限制
+	var hostLimit *checker.HostLimit
+	if *hostRPS < 0 || *hostBurst < 1 || *hostConcurrency < 0 {
+		log.Fatal("-host-rps 和 -host-concurrency 不能为负数，-host-burst 至少为 1")
+	}
+	if *hostRPS > 0 || *hostConcurrency > 0 {
+		hostLimit = &checker.HostLimit{RPS: *hostRPS, Burst: *hostBurst, MaxConcurrent: *hostConcurrency}
+	}
+
+	// -breaker 时熔断过的主机记在 breakers 中，最后输出到统计信息里。
+	// 单次运行中熔断之后不再恢复；监控模式下每隔 -breaker-cooldown 试探一次，状态变化打印到日志
+	var breaker *checker.BreakerPolicy
+	var breakers breakerLog
+	if *breakerThreshold < 0 {
+		log.Fatalf("-breaker 不能为负数: %d", *breakerThreshold)
+	}
+	if *breakerThreshold > 0 {
+		breaker = &checker.BreakerPolicy{Threshold: *breakerThreshold, OnChange: breakers.add}
+		if *watch {
+			if *breakerCooldown <= 0 {
+				log.Fatal("-breaker-cooldown 必须大于 0")
+			}
+			breaker.Cooldown = *breakerCooldown
+			breaker.OnChange = printBreaker
+		}
+	}
+
+	// 每个主机保留和 worker 一样多的空闲连接，所有 worker 同时检查一个站点时也不用重新建立连接
+	client := &http.Client{Transport: checker.NewTransport(checker.TransportOptions{
+		MaxIdleConnsPerHost: workers, MaxConnsPerHost: *maxConnsPerHost, DisableHTTP2: !*http2})}
+
+	// Ctrl-C 或超过 -deadline 时取消 ctx，正在进行的请求会立即返回
+	ctx := notifyContext()
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, *deadline, errDeadline)
+		defer cancel()
+	}
+
+	notifiers, err := notifyConfig{
+		Webhooks:        notifyWebhooks,
+		WebhookTemplate: *notifyTemplate,
+		SMTPAddr:        *notifySMTP,
+		SMTPUser:        *notifySMTPUser,
+		SMTPPassword:    os.Getenv("GOCHECKER_SMTP_PASSWORD"),
+		From:            *notifyFrom,
+		To:              notifyTo,
+		Exec:            *notifyExec,
+	}.build()
+	if err != nil {
+		log.Fatalf("通知参数错误: %v", err)
+	}
+	alerter := NewAlerter(*renotify, notifiers...)
+	defer alerter.Wait() // 退出前等待通知发送完
+	if len(notifiers) > 0 {
+		// 第一次见到的目标不会告警，单次运行要从历史记录中知道上一次的状态，否则永远不会发出通知
+		if *historyFile == "" && !*watch {
+			log.Fatal("单次运行时告警通知需要配合 -history 使用，用上一次运行的结果判断状态是否变化")
+		}
+		if *historyFile != "" {
+			states, err := lastStates(*historyFile)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Fatalf("读取历史文件失败: %v", err)
+			}
+			alerter.Restore(states)
+		}
+	}
+
+	var history *HistoryStore
+	if *historyFile != "" {
+		start := time.Now()
+		if history, err = OpenHistory(*historyFile, newRunID(start)); err != nil {
+			log.Fatalf("打开历史文件失败: %v", err)
+		}
+		if *watch {
+			// 一轮的长度是最长的检查间隔，每个目标在每一轮中至少检查一次
+			var round time.Duration
+			for _, t := range targets {
+				round = max(round, watchInterval(t, *interval))
+			}
+			history.RotateEvery(start, round)
+		}
+		defer history.Close() // 监控模式 return 时关闭；单次运行最后调用 os.Exit，不会执行 defer，在那之前关闭
+	}
+	saveHistory := func(res checker.Result) {
+		if history == nil {
+			return
+		}
+		if err := history.Append(res, time.Now()); err != nil {
+			log.Printf("写入历史文件失败: %v", err)
+		}
+	}
+
+	metrics := NewMetrics()
+	writeMetrics := func() {
+		if *metricsFile == "" {
+			return
+		}
+		if err := metrics.WriteFile(*metricsFile); err != nil {
+			log.Printf("写入指标文件失败: %v", err)
+		}
 	}
 
-	// 使用 tabwriter 格式化输出
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
-	fmt.Fprintln(w, "URL\tStatusCode\tLatency\tError\t")
-	fmt.Fprintln(w, "---\t----------\t-------\t-----\t")
+	opts := runOptions(*concurrency, client, adaptive, hostLimit, breaker)
+	if *watch {
+		if *metricsAddr != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics)
+			go func() {
+				log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+			}()
+		}
+		runWatch(ctx, targets, opts, *interval, *window, *summaryEvery, func(res checker.Result) {
+			metrics.Observe(res)
+			writeMetrics()
+			alerter.Observe(res, time.Now())
+			saveHistory(res)
+		})
+		return
+	}
+	if *metricsAddr != "" {
+		log.Fatal("-metrics-addr 需要配合 -watch 使用，单次运行请使用 -metrics-file")
+	}
 
-	var successCount, failCount int
-	var totalLatency time.Duration
+	// 报告用到的文件在所有参数都检查完之后才创建，参数错误退出时不会留下临时文件和空的 HTML 文件
+	var htmlOut *os.File
+	if *htmlFile != "" {
+		if htmlOut, err = os.Create(*htmlFile); err != nil {
+			log.Fatalf("创建 HTML 报告失败: %v", err)
+		}
+	}
+	// 从这里到最后的退出之间不再调用 log.Fatal 和 os.Exit：出错时只记下错误，
+	// 等关闭报告（删除临时文件）、关闭仪表盘（恢复终端）、等通知发完、关闭历史文件之后再退出
+	var reportOut io.Writer = os.Stdout
+	var reportFile *os.File
+	if useTUI {
+		if f, err := os.CreateTemp("", "go-checker-report-*"); err != nil {
+			log.Printf("创建临时文件失败，不显示仪表盘: %v", err)
+			useTUI, progress = false, os.Stderr
+		} else {
+			reportFile, reportOut = f, f
+		}
+	}
+	report, _ := newReportWriter(*output, reportOut) // 参数在前面已经检查过了
+	if htmlOut != nil {
+		report = teeWriter{report, newHTMLWriter(htmlOut)}
+	}
+	report, _ = arrangeReport(report, *order, *sortBy)
+	// -order input 时读取目标的速度受暂存结果的数量限制，见 orderedWriter
+	admit := func(context.Context) {}
+	if o, ok := report.(*orderedWriter); ok {
+		admit = o.admit
+	}
 
-	for _, res := range allResults {
-		if res.Error != nil {
-			fmt.Fprintf(w, "%s\tN/A\tN/A\t%v\t\n", res.URL, res.Error)
-			failCount++
+	// -tui 时打开仪表盘，worker 开始检查时更新它的 worker 列表，按 q 和 Ctrl-C 一样取消剩下的检查。
+	// 写报告失败时同样取消剩下的检查，原因是写报告的错误
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	var dash *dashboard
+	if useTUI {
+		if dash, err = newDashboard(os.Stdout, workers, func() { stop(errDashboardQuit) }); err != nil {
+			log.Printf("打开仪表盘失败，改为普通输出: %v", err)
+			progress = os.Stderr
 		} else {
-			fmt.Fprintf(w, "%s\t%d\t%v\t%s\t\n", res.URL, res.StatusCode, res.Latency, "N/A")
-			successCount++
-			totalLatency += res.Latency
+			opts.OnStart = dash.start
+		}
+	}
+
+	// 每拿到一个结果就处理：统计、写报告都是增量的，结果本身不保存。
+	// 指标和告警会按目标记录状态，只在用到时才调用
+	var recorder SummaryRecorder
+	var writeErr error // 第一次写报告失败的错误，之后的结果不再写
+	collect := func(result checker.Result) {
+		recorder.Add(result)
+		breakers.skip(result)
+		dash.observe(result)
+		if *metricsFile != "" {
+			metrics.Observe(result)
+		}
+		if len(notifiers) > 0 {
+			alerter.Observe(result, time.Now())
+		}
+		saveHistory(result)
+		if writeErr != nil {
+			return
+		}
+		if err := report.WriteResult(result); err != nil {
+			writeErr = fmt.Errorf("输出结果失败: %w", err)
+			stop(writeErr)
 		}
 	}
-	w.Flush() // 不要忘记 Flush
 
-	// 打印统计信息
-	fmt.Println("\n--- 统计信息 ---")
-	fmt.Printf("总计URL数量: %d\n", len(allResults))
-	fmt.Printf("成功数量: %d\n", successCount)
-	fmt.Printf("失败数量: %d\n", failCount)
-	if successCount > 0 {
-		fmt.Printf("平均延迟: %v\n", totalLatency/time.Duration(successCount))
+	var inputErr error
+	if crawler != nil {
+		crawler.Run(ctx, opts, collect)
+	} else {
+		// jobs 的容量和 worker 数量一样，读取速度只比检查快一点点，内存中最多只有这么多个待检查的目标
+		jobs := make(chan checker.Target, workers)
+		go func() {
+			defer dash.inputClosed()
+			inputErr = feedTargets(stream, jobs, func(t *checker.Target) {
+				applyDefaults(t, defaults)
+				dash.addTarget()
+				admit(ctx)
+			})
+		}()
+		for result := range checker.RunStream(ctx, jobs, opts) {
+			collect(result)
+		}
+	}
+
+	summary := recorder.Summary()
+	summary.Concurrency = timeline.list()
+	summary.TrippedHosts = breakers.list()
+	// 写结果失败时也要调用 Close，它会删除 -html 等报告写到一半的临时文件
+	reportErr := writeErr
+	if err := report.Close(summary); err != nil {
+		reportErr = errors.Join(reportErr, fmt.Errorf("输出报告失败: %w", err))
+	}
+	if htmlOut != nil {
+		if err := htmlOut.Close(); err != nil {
+			reportErr = errors.Join(reportErr, fmt.Errorf("输出 HTML 报告失败: %w", err))
+		}
+	}
+	dash.close() // 恢复终端，之后的日志才能看到
+	if reportFile != nil {
+		if err := copyReport(os.Stdout, reportFile); err != nil {
+			reportErr = errors.Join(reportErr, fmt.Errorf("输出报告失败: %w", err))
+		}
+	}
+	writeMetrics()
+	alerter.Wait() // os.Exit 不会执行 defer
+	if history != nil {
+		if err := history.Close(); err != nil {
+			log.Printf("写入历史文件失败: %v", err)
+		}
+	}
+	if reportErr != nil {
+		log.Fatal(reportErr)
+	}
+	if inputErr != nil {
+		// 报告中只有出错之前读到的目标，不能当作全部成功
+		log.Printf("读取目标列表失败: %v", inputErr)
+		os.Exit(exitFail)
+	}
+	os.Exit(exitCode(summary))
+}
+
+// applyDefaults 把命令行上的断言、重试和重定向策略填到目标中没有设置的地方
+func applyDefaults(t *checker.Target, defaults checker.Target) {
+	if t.Expect == nil {
+		t.Expect = defaults.Expect
+	}
+	if t.Retry == nil {
+		t.Retry = defaults.Retry
+	}
+	if t.Redirect == nil {
+		t.Redirect = defaults.Redirect
+	}
+	if t.CertWarn == 0 {
+		t.CertWarn = defaults.CertWarn
 	}
-	fmt.Println("-----------------")
+	t.Insecure = t.Insecure || defaults.Insecure
+	t.FreshConn = t.FreshConn || defaults.FreshConn
 }
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"sync"
 	"testing"
+
+	"go-learning/go-checker/version4/checker"
 )
 
 func TestCheckURL(t *testing.T) {
@@ -15,7 +18,7 @@ func TestCheckURL(t *testing.T) {
 	}))
 	defer server.Close()
 
-	result := checkURL(server.URL)
+	result := checker.CheckURL(context.Background(), server.URL)
 
 	if result.Error != nil {
 		t.Errorf("期望没有错误，但得到了: %v", result.Error)
@@ -28,7 +31,7 @@ func TestCheckURL(t *testing.T) {
 	}
 
 	// 测试一个无效的 URL
-	invalidResult := checkURL("[http://invalid-url-that-will-fail.com](http://invalid-url-that-will-fail.com)")
+	invalidResult := checker.CheckURL(context.Background(), "[http://invalid-url-that-will-fail.com](http://invalid-url-that-will-fail.com)")
 	if invalidResult.Error == nil {
 		t.Error("期望得到一个错误，但没有得到")
 	}
@@ -62,7 +65,7 @@ func BenchmarkSequentialCheck(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		for _, url := range urls {
-			checkURL(url)
+			checker.CheckURL(context.Background(), url)
 		}
 	}
 }
@@ -80,7 +83,7 @@ func BenchmarkConcurrentCheck(b *testing.B) {
 			wg.Add(1)
 			go func(u string) {
 				defer wg.Done()
-				checkURL(u)
+				checker.CheckURL(context.Background(), u)
 			}(url)
 		}
 		wg.Wait()
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// latencyBuckets 是延迟直方图的桶边界（秒），和 Prometheus 客户端库的默认值一致
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics 汇总检查结果，并按照 Prometheus 的文本格式输出。
+// 知识点：Prometheus 的文本格式很简单，每行是 "指标名{标签} 值"，
+// 所以这里不引入第三方客户端库，直接手写输出。
+type Metrics struct {
+	mu      sync.Mutex
+	targets map[string]*targetMetrics
+}
+
+// targetMetrics 是一个目标的所有指标
+type targetMetrics struct {
+	labels     string // 已经拼好的标签，如 target="首页",url="https://a.com",kind="http",tags="web"
+	up         bool
+	status     int
+	lastCheck  time.Time
+	certExpiry time.Time // 证书链最早的过期时间，非 https、tls 检查为零值
+	success    uint64
+	failure    uint64
+	buckets    []uint64 // 每个桶的累计计数，和 latencyBuckets 一一对应
+	sum        float64  // 延迟总和（秒）
+	count      uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{targets: make(map[string]*targetMetrics)}
+}
+
+// Observe 记录一次检查结果
+func (m *Metrics) Observe(res checker.Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := res.Name + "\x00" + res.URL
+	tm, ok := m.targets[key]
+	if !ok {
+		tm = &targetMetrics{labels: resultLabels(res), buckets: make([]uint64, len(latencyBuckets))}
+		m.targets[key] = tm
+	}
+
+	tm.up = res.OK()
+	tm.status = res.StatusCode
+	tm.lastCheck = time.Now()
+	if res.Cert != nil {
+		tm.certExpiry = res.Cert.ChainExpiry
+	}
+	if !tm.up {
+		tm.failure++
+		return
+	}
+	tm.success++
+
+	// 延迟直方图只统计成功的检查，失败的请求往往是超时，会把分布拉偏
+	seconds := res.Latency.Seconds()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			tm.buckets[i]++
+		}
+	}
+	tm.sum += seconds
+	tm.count++
+}
+
+// resultLabels 拼出一个目标的标签，多个标签值用逗号连接
+func resultLabels(res checker.Result) string {
+	tags := append([]string(nil), res.Tags...)
+	sort.Strings(tags)
+	return fmt.Sprintf(`target="%s",url="%s",kind="%s",tags="%s"`,
+		escapeLabel(resultKey(res)), escapeLabel(res.URL), escapeLabel(res.Kind), escapeLabel(strings.Join(tags, ",")))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel 按照 Prometheus 文本格式的要求转义标签值
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// WriteTo 按照 Prometheus 文本格式输出所有指标，实现了 io.WriterTo 接口
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// map 的遍历顺序是随机的，排序后输出更稳定，也方便比较
+	all := make([]*targetMetrics, 0, len(m.targets))
+	for _, tm := range m.targets {
+		all = append(all, tm)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].labels < all[j].labels })
+
+	var buf bytes.Buffer
+	family := func(name, typ, help string, each func(tm *targetMetrics)) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, tm := range all {
+			each(tm)
+		}
+	}
+
+	family("gochecker_up", "gauge", "最近一次检查是否成功（1 成功，0 失败）", func(tm *targetMetrics) {
+		fmt.Fprintf(&buf, "gochecker_up{%s} %d\n", tm.labels, boolToInt(tm.up))
+	})
+	family("gochecker_http_status_code", "gauge", "最近一次检查的 HTTP 状态码，非 HTTP 检查或请求失败时为 0", func(tm *targetMetrics) {
+		fmt.Fprintf(&buf, "gochecker_http_status_code{%s} %d\n", tm.labels, tm.status)
+	})
+	family("gochecker_last_check_timestamp_seconds", "gauge", "最近一次检查的 Unix 时间戳", func(tm *targetMetrics) {
+		fmt.Fprintf(&buf, "gochecker_last_check_timestamp_seconds{%s} %d\n", tm.labels, tm.lastCheck.Unix())
+	})
+	family("gochecker_cert_expiry_timestamp_seconds", "gauge", "证书链最早过期时间的 Unix 时间戳，只有 https 和 tls 检查才有", func(tm *targetMetrics) {
+		if !tm.certExpiry.IsZero() {
+			fmt.Fprintf(&buf, "gochecker_cert_expiry_timestamp_seconds{%s} %d\n", tm.labels, tm.certExpiry.Unix())
+		}
+	})
+	family("gochecker_checks_total", "counter", "检查次数，按结果区分", func(tm *targetMetrics) {
+		fmt.Fprintf(&buf, "gochecker_checks_total{%s,result=\"success\"} %d\n", tm.labels, tm.success)
+		fmt.Fprintf(&buf, "gochecker_checks_total{%s,result=\"failure\"} %d\n", tm.labels, tm.failure)
+	})
+	family("gochecker_latency_seconds", "histogram", "成功检查的延迟分布", func(tm *targetMetrics) {
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(&buf, "gochecker_latency_seconds_bucket{%s,le=\"%s\"} %d\n", tm.labels, formatFloat(le), tm.buckets[i])
+		}
+		fmt.Fprintf(&buf, "gochecker_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", tm.labels, tm.count)
+		fmt.Fprintf(&buf, "gochecker_latency_seconds_sum{%s} %s\n", tm.labels, formatFloat(tm.sum))
+		fmt.Fprintf(&buf, "gochecker_latency_seconds_count{%s} %d\n", tm.labels, tm.count)
+	})
+
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP 让 Metrics 可以直接注册为 /metrics 的处理器
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteFile 把指标写到文件中，供 node_exporter 的 textfile collector 读取。
+// 先写临时文件再重命名，保证 collector 不会读到写了一半的文件。
+func (m *Metrics) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后这里什么也不会删除
+
+	if _, err := m.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
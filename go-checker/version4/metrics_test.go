@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics()
+	ok := checker.Result{Name: "首页", URL: "https://a.com", Kind: "http", StatusCode: 200, Latency: 30 * time.Millisecond, Tags: []string{"web", "prod"}}
+	m.Observe(ok)
+	m.Observe(ok)
+	m.Observe(checker.Result{Name: "首页", URL: "https://a.com", Kind: "http", Tags: []string{"web", "prod"}, Error: errors.New("timeout")})
+
+	server := httptest.NewServer(m)
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+
+	labels := `target="首页",url="https://a.com",kind="http",tags="prod,web"`
+	for _, want := range []string{
+		"# TYPE gochecker_up gauge",
+		"gochecker_up{" + labels + "} 0",
+		"gochecker_checks_total{" + labels + `,result="success"} 2`,
+		"gochecker_checks_total{" + labels + `,result="failure"} 1`,
+		"gochecker_latency_seconds_bucket{" + labels + `,le="0.025"} 0`,
+		"gochecker_latency_seconds_bucket{" + labels + `,le="0.05"} 2`,
+		"gochecker_latency_seconds_bucket{" + labels + `,le="+Inf"} 2`,
+		"gochecker_latency_seconds_count{" + labels + "} 2",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("期望指标中包含 %q\n实际输出:\n%s", want, text)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("转义错误: %s", got)
+	}
+}
+
+func TestMetricsWriteFile(t *testing.T) {
+	m := NewMetrics()
+	m.Observe(checker.Result{URL: "tcp://db:3306", Kind: "tcp", Latency: time.Millisecond})
+
+	path := filepath.Join(t.TempDir(), "gochecker.prom")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatalf("期望没有错误，但得到了: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `gochecker_up{target="tcp://db:3306",url="tcp://db:3306",kind="tcp",tags=""} 1`) {
+		t.Errorf("指标文件内容错误:\n%s", data)
+	}
+
+	// 临时文件应该已经被重命名，目录里只剩最终的文件
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("期望目录中只有 1 个文件, 但得到了 %d 个", len(entries))
+	}
+}
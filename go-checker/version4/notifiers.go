@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// eventRecord 是 Event 在 JSON 中的样子，webhook 的默认请求体和 exec 的标准输入都使用它
+type eventRecord struct {
+	Kind     EventKind    `json:"kind"`
+	Target   string       `json:"target"`
+	URL      string       `json:"url"`
+	State    State        `json:"state"`
+	Previous State        `json:"previous_state"`
+	At       time.Time    `json:"at"`
+	Since    time.Time    `json:"since"`
+	Reason   string       `json:"reason,omitempty"`
+	Message  string       `json:"message"`
+	Result   resultRecord `json:"result"`
+}
+
+func newEventRecord(e Event) eventRecord {
+	return eventRecord{
+		Kind:     e.Kind,
+		Target:   e.Target,
+		URL:      e.URL,
+		State:    e.State,
+		Previous: e.Previous,
+		At:       e.At,
+		Since:    e.Since,
+		Reason:   e.Reason,
+		Message:  e.Message(),
+		Result:   newResultRecord(e.Result),
+	}
+}
+
+// WebhookNotifier 把通知以 JSON POST 到一个 URL。
+// Template 为 nil 时请求体是 eventRecord；否则用模板生成请求体，
+// 模板中可以使用 Event 的字段和 Message 方法，以及把值转成 JSON 字符串的 json 函数，如：
+//
+//	{"text": {{json .Message}}}
+type WebhookNotifier struct {
+	URL      string
+	Template *template.Template
+}
+
+// parseWebhookTemplate 解析 webhook 的请求体模板
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, e Event) error {
+	var body bytes.Buffer
+	if w.Template != nil {
+		if err := w.Template.Execute(&body, e); err != nil {
+			return fmt.Errorf("生成 webhook 请求体失败: %v", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(newEventRecord(e)); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s 返回了状态码 %d", w.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPNotifier 通过 SMTP 发送邮件，Username 为空时不做认证（适合本机或内网的邮件中继）
+type SMTPNotifier struct {
+	Addr     string // host:port
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+func (s *SMTPNotifier) Notify(ctx context.Context, e Event) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	// 知识点：邮件头只能是 ASCII，中文标题要按 RFC 2047 编码
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mimeHeader(e.Message()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", e.At.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", e.Message())
+	fmt.Fprintf(&msg, "目标: %s\r\nURL: %s\r\n状态: %s → %s\r\n时间: %s\r\n",
+		e.Target, e.URL, e.Previous, e.State, e.At.Format("2006-01-02 15:04:05"))
+	if e.Reason != "" {
+		fmt.Fprintf(&msg, "原因: %s\r\n", e.Reason)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	// smtp.SendMail 不支持 context，放到 goroutine 中执行，超时后直接返回
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.Addr, auth, s.From, s.To, msg.Bytes()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mimeHeader 按 RFC 2047 编码邮件头中的非 ASCII 字符
+func mimeHeader(s string) string {
+	return mime.QEncoding.Encode("utf-8", s)
+}
+
+// ExecNotifier 执行一个外部命令，事件的 JSON 从标准输入传入，
+// 常用的字段也放在 GOCHECKER_ 开头的环境变量里，方便写 shell 脚本
+type ExecNotifier struct {
+	Command []string // 程序和参数，不经过 shell
+}
+
+func (x *ExecNotifier) Notify(ctx context.Context, e Event) error {
+	if len(x.Command) == 0 {
+		return errors.New("exec 通知缺少命令")
+	}
+	data, err := json.Marshal(newEventRecord(e))
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, x.Command[0], x.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"GOCHECKER_EVENT="+string(e.Kind),
+		"GOCHECKER_TARGET="+e.Target,
+		"GOCHECKER_URL="+e.URL,
+		"GOCHECKER_STATE="+string(e.State),
+		"GOCHECKER_PREVIOUS_STATE="+string(e.Previous),
+		"GOCHECKER_REASON="+e.Reason,
+		"GOCHECKER_MESSAGE="+e.Message(),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", x.Command[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// notifyConfig 是命令行上的通知参数
+type notifyConfig struct {
+	Webhooks        []string
+	WebhookTemplate string // 模板文件的路径
+	SMTPAddr        string
+	SMTPUser        string
+	SMTPPassword    string
+	From            string
+	To              []string
+	Exec            string // 按空白分隔成程序和参数
+}
+
+// build 根据参数创建所有的 Notifier，没有配置任何通知时返回 nil
+func (c notifyConfig) build() ([]Notifier, error) {
+	var notifiers []Notifier
+	var tmpl *template.Template
+	if c.WebhookTemplate != "" {
+		data, err := os.ReadFile(c.WebhookTemplate)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl, err = parseWebhookTemplate(string(data)); err != nil {
+			return nil, fmt.Errorf("webhook 模板错误: %v", err)
+		}
+	}
+	for _, u := range c.Webhooks {
+		notifiers = append(notifiers, &WebhookNotifier{URL: u, Template: tmpl})
+	}
+	if c.SMTPAddr != "" {
+		if c.From == "" || len(c.To) == 0 {
+			return nil, errors.New("邮件通知需要同时设置发件人和收件人")
+		}
+		notifiers = append(notifiers, &SMTPNotifier{Addr: c.SMTPAddr, From: c.From, To: c.To, Username: c.SMTPUser, Password: c.SMTPPassword})
+	}
+	if command := strings.Fields(c.Exec); len(command) > 0 {
+		notifiers = append(notifiers, &ExecNotifier{Command: command})
+	}
+	return notifiers, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// notifyTimeout 是发送一条通知的超时时间
+const notifyTimeout = 10 * time.Second
+
+// EventKind 是通知的类型
+type EventKind string
+
+const (
+	EventAlert    EventKind = "alert"    // 目标进入 DOWN 或 WARN 状态
+	EventReminder EventKind = "reminder" // 目标一直没有恢复，按 -renotify 间隔再次提醒
+	EventRecovery EventKind = "recovery" // 发过告警的目标恢复为 UP
+)
+
+// Event 是一条要发送的通知
+type Event struct {
+	Kind     EventKind
+	Target   string // 目标名称，没有名称时是 URL
+	URL      string
+	State    State
+	Previous State
+	At       time.Time
+	Since    time.Time // 进入当前状态的时间，恢复通知中是异常开始的时间
+	Reason   string    // 失败或警告的原因，恢复时为空
+	Result   checker.Result
+}
+
+// Message 返回一行适合作为邮件标题、聊天消息的文字
+func (e Event) Message() string {
+	switch e.Kind {
+	case EventRecovery:
+		return fmt.Sprintf("[go-checker] 已恢复: %s %s→%s（异常持续了 %v）",
+			e.Target, e.Previous, e.State, e.At.Sub(e.Since).Round(time.Second))
+	case EventReminder:
+		return fmt.Sprintf("[go-checker] 仍未恢复: %s %s（已持续 %v）: %s",
+			e.Target, e.State, e.At.Sub(e.Since).Round(time.Second), e.Reason)
+	}
+	return fmt.Sprintf("[go-checker] %s %s→%s: %s", e.Target, e.Previous, e.State, e.Reason)
+}
+
+// Notifier 把通知发送到某个地方，如 webhook、邮件、外部命令
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Alerter 根据检查结果决定什么时候发送通知：
+//   - 进入 DOWN 或 WARN 时发送告警，状态不变时不会重复发送（去重）
+//   - 一直没有恢复时，每隔 renotify 再提醒一次，renotify 为 0 时不提醒
+//   - 发过告警的目标恢复为 UP 时发送恢复通知
+//   - 第一次见到的目标只记录状态，不知道之前的状态就不能判断是不是变化。
+//     单次运行时用 Restore 读入历史记录中的状态，才能和上一次运行的状态比较
+//
+// 每个 Notifier 有一个自己的队列，由一个后台 goroutine 按顺序发送，不会阻塞检查，
+// 同一个目标的恢复通知也不会比告警先到。发送失败只记录日志。
+type Alerter struct {
+	renotify time.Duration
+	queues   []chan Event
+
+	mu     sync.Mutex
+	states map[string]*alertState
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// alertQueueSize 是每个 Notifier 的队列长度，队列满了之后 Observe 会等待
+const alertQueueSize = 256
+
+// alertState 是一个目标的告警状态
+type alertState struct {
+	state        State
+	since        time.Time
+	alerted      bool // 当前这次异常是否已经发过告警
+	lastNotified time.Time
+}
+
+func NewAlerter(renotify time.Duration, notifiers ...Notifier) *Alerter {
+	a := &Alerter{renotify: renotify, states: make(map[string]*alertState)}
+	for _, n := range notifiers {
+		q := make(chan Event, alertQueueSize)
+		a.queues = append(a.queues, q)
+		a.wg.Add(1)
+		go a.send(n, q)
+	}
+	return a
+}
+
+// send 按顺序发送队列中的通知，直到队列被 Wait 关闭
+func (a *Alerter) send(n Notifier, q <-chan Event) {
+	defer a.wg.Done()
+	for e := range q {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		if err := n.Notify(ctx, e); err != nil {
+			log.Printf("发送通知失败（%T）: %v", n, err)
+		}
+		cancel()
+	}
+}
+
+// isProblem 判断一个状态是否需要告警
+func isProblem(s State) bool {
+	return s == StateDown || s == StateWarn
+}
+
+// Observe 记录一次检查结果，需要通知时放进每个 Notifier 的队列。被取消的检查不代表目标的状态，直接忽略。
+func (a *Alerter) Observe(res checker.Result, at time.Time) {
+	if res.Category() == checker.CategoryCanceled {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock() // 入队也在锁里，保证通知的顺序和判断的顺序一致
+	e, ok := a.decide(res, at)
+	if !ok || a.closed {
+		return
+	}
+	for _, q := range a.queues {
+		q <- e
+	}
+}
+
+// Restore 恢复每个目标在历史记录中最后的状态，不发送通知。
+// 历史中是 DOWN 或 WARN 的目标当作已经告警过：状态不变时不重复告警，恢复时发送恢复通知。
+// 历史中没有记录上次通知的时间，按照异常开始之后每隔 renotify 提醒一次来推算
+func (a *Alerter) Restore(states map[string]historyState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, h := range states {
+		st := &alertState{state: h.State, since: h.Since, alerted: isProblem(h.State), lastNotified: h.Since}
+		if a.renotify > 0 {
+			st.lastNotified = h.Since.Add(h.Last.Sub(h.Since) / a.renotify * a.renotify)
+		}
+		a.states[key] = st
+	}
+}
+
+// decide 更新目标的告警状态，并判断这次结果是否需要通知，调用时要持有 mu
+func (a *Alerter) decide(res checker.Result, at time.Time) (Event, bool) {
+	e := Event{Target: resultKey(res), URL: res.URL, State: stateOf(res), At: at, Result: res}
+	if isProblem(e.State) {
+		e.Reason = errorText(res)
+	}
+	ok := a.advance(&e)
+	return e, ok
+}
+
+// advance 按 e 的 Target、State 和 At 更新告警状态，填上 Kind、Previous 和 Since，返回是否需要通知
+func (a *Alerter) advance(e *Event) bool {
+	st, ok := a.states[e.Target]
+	if !ok {
+		a.states[e.Target] = &alertState{state: e.State, since: e.At}
+		return false
+	}
+	e.Previous, e.Since = st.state, st.since
+
+	if e.State == st.state {
+		if !st.alerted || a.renotify <= 0 || e.At.Sub(st.lastNotified) < a.renotify {
+			return false
+		}
+		e.Kind = EventReminder
+		st.lastNotified = e.At
+		return true
+	}
+
+	st.state, st.since = e.State, e.At
+	switch {
+	case isProblem(e.State):
+		e.Kind = EventAlert
+		e.Since = e.At
+		st.alerted, st.lastNotified = true, e.At
+		return true
+	case st.alerted: // 从异常恢复，Since 保留异常开始的时间，用来计算持续时间
+		e.Kind = EventRecovery
+		st.alerted = false
+		return true
+	}
+	return false
+}
+
+// Wait 关闭队列并等待所有通知发送完，程序退出前调用，之后的结果不再通知。可以调用多次
+func (a *Alerter) Wait() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		for _, q := range a.queues {
+			close(q)
+		}
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestAlerterDecide(t *testing.T) {
+	up := checker.Result{URL: "https://a.com", StatusCode: 200}
+	down := checker.Result{URL: "https://a.com", Error: errors.New("connection refused")}
+	a := NewAlerter(10 * time.Minute)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		res  checker.Result
+		at   time.Duration
+		want EventKind // 为空表示不应该通知
+	}{
+		{up, 0, ""},                             // 第一次见到，只记录状态
+		{down, time.Minute, EventAlert},         // UP→DOWN
+		{down, 2 * time.Minute, ""},             // 仍然 DOWN，去重
+		{down, 11 * time.Minute, EventReminder}, // 距离上次通知超过 10 分钟
+		{down, 12 * time.Minute, ""},
+		{up, 15 * time.Minute, EventRecovery}, // DOWN→UP
+		{up, 16 * time.Minute, ""},
+	}
+	for i, s := range steps {
+		e, ok := a.decide(s.res, start.Add(s.at))
+		if got := EventKind(""); ok {
+			got = e.Kind
+			if got != s.want {
+				t.Errorf("第 %d 步: 期望 %q, 但得到了 %q", i+1, s.want, got)
+			}
+		} else if s.want != "" {
+			t.Errorf("第 %d 步: 期望通知 %q, 但没有通知", i+1, s.want)
+		}
+	}
+
+	// 第一次见到时已经是 DOWN，不知道是不是刚出问题，不告警；之后恢复也不发送恢复通知
+	a = NewAlerter(0)
+	if _, ok := a.decide(down, start); ok {
+		t.Error("期望第一次见到的目标不告警")
+	}
+	if _, ok := a.decide(up, start.Add(time.Minute)); ok {
+		t.Error("期望没有告警过的目标恢复时不通知")
+	}
+
+	// 恢复通知里的持续时间从第一次告警算起
+	a.decide(down, start)
+	e, _ := a.decide(up, start.Add(5*time.Minute))
+	if !strings.Contains(e.Message(), "5m0s") {
+		t.Errorf("期望恢复消息包含异常持续的时间, 但得到了 %q", e.Message())
+	}
+}
+
+func TestAlerterRestore(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	up := checker.Result{URL: "https://a.com", StatusCode: 200}
+	down := checker.Result{URL: "https://a.com", Error: errors.New("connection refused")}
+
+	// 上一次运行是 UP，这次 DOWN 要告警
+	a := NewAlerter(0)
+	a.Restore(map[string]historyState{"https://a.com": {State: StateUp, Since: start, Last: start}})
+	if e, ok := a.decide(down, start.Add(time.Minute)); !ok || e.Kind != EventAlert || e.Previous != StateUp {
+		t.Errorf("期望和历史中的状态比较之后告警, 但得到了 %+v", e)
+	}
+
+	// 历史中已经是 DOWN 的目标不重复告警，按 renotify 的间隔提醒，恢复时发送恢复通知
+	a = NewAlerter(10 * time.Minute)
+	a.Restore(map[string]historyState{"https://a.com": {State: StateDown, Since: start, Last: start.Add(12 * time.Minute)}})
+	if _, ok := a.decide(down, start.Add(13*time.Minute)); ok {
+		t.Error("期望历史中已经是 DOWN 的目标不重复告警")
+	}
+	if e, ok := a.decide(down, start.Add(21*time.Minute)); !ok || e.Kind != EventReminder {
+		t.Errorf("期望异常 20 分钟时提醒, 但得到了 %+v", e)
+	}
+	if e, ok := a.decide(up, start.Add(25*time.Minute)); !ok || e.Kind != EventRecovery || !strings.Contains(e.Message(), "25m0s") {
+		t.Errorf("期望恢复通知从历史中的异常开始时间算起, 但得到了 %+v", e)
+	}
+}
+
+// orderNotifier 记录收到的通知，第一条通知故意发送得慢一些
+type orderNotifier struct {
+	mu    sync.Mutex
+	kinds []EventKind
+}
+
+func (n *orderNotifier) Notify(ctx context.Context, e Event) error {
+	if e.Kind == EventAlert {
+		time.Sleep(20 * time.Millisecond)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.kinds = append(n.kinds, e.Kind)
+	return nil
+}
+
+func TestAlerterOrder(t *testing.T) {
+	n := &orderNotifier{}
+	a := NewAlerter(0, n)
+	now := time.Now()
+	a.Observe(checker.Result{URL: "https://a.com", StatusCode: 200}, now)
+	a.Observe(checker.Result{URL: "https://a.com", Error: errors.New("timeout")}, now.Add(time.Second))
+	a.Observe(checker.Result{URL: "https://a.com", StatusCode: 200}, now.Add(2*time.Second))
+	a.Wait()
+	a.Wait() // 可以调用多次
+	if len(n.kinds) != 2 || n.kinds[0] != EventAlert || n.kinds[1] != EventRecovery {
+		t.Errorf("期望按顺序收到告警和恢复通知, 但得到了 %v", n.kinds)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(data))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tmpl, err := parseWebhookTemplate(`{"text": {{json .Message}}, "state": "{{.State}}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAlerter(0, &WebhookNotifier{URL: server.URL}, &WebhookNotifier{URL: server.URL, Template: tmpl})
+	a.Observe(checker.Result{Name: "首页", URL: "https://a.com", StatusCode: 200}, time.Now())
+	a.Observe(checker.Result{Name: "首页", URL: "https://a.com", Error: errors.New("timeout")}, time.Now())
+	a.Wait()
+
+	if len(bodies) != 2 {
+		t.Fatalf("期望收到 2 条通知, 但得到了 %d 条", len(bodies))
+	}
+	var rec eventRecord
+	var templated struct{ Text, State string }
+	for _, body := range bodies {
+		if strings.Contains(body, `"kind"`) {
+			err = json.Unmarshal([]byte(body), &rec)
+		} else {
+			err = json.Unmarshal([]byte(body), &templated)
+		}
+		if err != nil {
+			t.Fatalf("请求体不是合法的 JSON: %v\n%s", err, body)
+		}
+	}
+	if rec.Kind != EventAlert || rec.Target != "首页" || rec.State != StateDown || rec.Result.URL != "https://a.com" {
+		t.Errorf("默认请求体错误: %+v", rec)
+	}
+	if templated.State != "DOWN" || !strings.Contains(templated.Text, "首页") {
+		t.Errorf("模板生成的请求体错误: %+v", templated)
+	}
+}
+
+// smtpStandIn 是一个只实现了最基本命令的 SMTP 服务器，收到的邮件内容发送到返回的 channel
+func smtpStandIn(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					mails <- data.String()
+					reply("250 OK")
+				} else {
+					data.WriteString(line)
+				}
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "DATA":
+				inData = true
+				reply("354 go ahead")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default: // EHLO、MAIL、RCPT 等
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mails := smtpStandIn(t)
+	n := &SMTPNotifier{Addr: addr, From: "checker@example.com", To: []string{"ops@example.com"}}
+	e := Event{Kind: EventAlert, Target: "首页", URL: "https://a.com", State: StateDown, Previous: StateUp, At: time.Now(), Reason: "timeout"}
+	if err := n.Notify(context.Background(), e); err != nil {
+		t.Fatalf("发送邮件失败: %v", err)
+	}
+	mail := <-mails
+	if !strings.Contains(mail, "To: ops@example.com") || !strings.Contains(mail, "Subject: =?utf-8?q?") || !strings.Contains(mail, "原因: timeout") {
+		t.Errorf("邮件内容错误:\n%s", mail)
+	}
+}
+
+func TestExecNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event.json")
+	n := &ExecNotifier{Command: []string{"sh", "-c", `[ "$GOCHECKER_EVENT" = recovery ] && cat > "$1"`, "sh", out}}
+	e := Event{Kind: EventRecovery, Target: "数据库", URL: "tcp://127.0.0.1:3306", State: StateUp, Previous: StateDown, At: time.Now()}
+	if err := n.Notify(context.Background(), e); err != nil {
+		t.Fatalf("执行命令失败: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec eventRecord
+	if err := json.Unmarshal(data, &rec); err != nil || rec.Target != "数据库" {
+		t.Errorf("期望从标准输入收到事件 JSON, 但得到了 %s", data)
+	}
+
+	if err := (&ExecNotifier{Command: []string{"sh", "-c", "echo boom >&2; exit 3"}}).Notify(context.Background(), e); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("期望命令失败时返回带有输出的错误, 但得到了 %v", err)
+	}
+}
@@ -0,0 +1,1003 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// Summary 是一次运行的统计信息
+type Summary struct {
+	Total            int
+	Success          int
+	Fail             int
+	Warn             int           // 成功但带有警告的数量，包含在 Success 中
+	Canceled         int           // 被取消的数量，包含在 Fail 中
+	Skipped          int           // 主机熔断而跳过的数量，包含在 Fail 中
+	PassedOnRetry    int           // 重试后才成功的数量，包含在 Success 中
+	FailedAfterRetry int           // 重试后仍然失败的数量，包含在 Fail 中
+	AvgLatency       time.Duration // 只统计成功的检查，下同
+	Latency          LatencyStats
+	Histogram        []HistogramBucket
+	Concurrency      []checker.Resize // -adaptive 时并发数的变化，第一个是初始值
+	TrippedHosts     []TrippedHost    // -breaker 时熔断过的主机
+}
+
+// SummaryRecorder 边收结果边统计，不保存结果本身，目标再多内存占用也是固定的
+type SummaryRecorder struct {
+	s       Summary
+	latency LatencyRecorder // 只统计成功的检查
+}
+
+// Add 统计一个结果
+func (r *SummaryRecorder) Add(res checker.Result) {
+	s := &r.s
+	s.Total++
+	if res.OK() {
+		s.Success++
+		r.latency.Add(res.Latency)
+		if res.Warn() {
+			s.Warn++
+		}
+		if res.Retried() {
+			s.PassedOnRetry++
+		}
+	} else {
+		s.Fail++
+		switch res.Category() {
+		case checker.CategoryCanceled:
+			s.Canceled++
+		case checker.CategorySkipped:
+			s.Skipped++
+		}
+		if res.Retried() {
+			s.FailedAfterRetry++
+		}
+	}
+}
+
+// Summary 返回目前为止的统计信息
+func (r *SummaryRecorder) Summary() Summary {
+	s := r.s
+	s.Latency = r.latency.Stats()
+	s.AvgLatency = s.Latency.Mean
+	s.Histogram = r.latency.Histogram()
+	return s
+}
+
+// concurrencyTimeline 记录 -adaptive 时并发数的变化。
+// OnResize 在 worker 池自己的 goroutine 中调用，所以需要加锁
+type concurrencyTimeline struct {
+	mu      sync.Mutex
+	resizes []checker.Resize
+}
+
+func (c *concurrencyTimeline) add(r checker.Resize) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resizes = append(c.resizes, r)
+}
+
+func (c *concurrencyTimeline) list() []checker.Resize {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.resizes)
+}
+
+// maxTimelineRows 是文本报告中最多列出的并发数变化次数，超过时均匀地抽取，保留第一次和最后一次
+const maxTimelineRows = 20
+
+// printConcurrency 输出并发数的变化
+func printConcurrency(w io.Writer, resizes []checker.Resize) {
+	if len(resizes) == 0 {
+		return
+	}
+	lo, hi := resizes[0].To, resizes[0].To
+	for _, r := range resizes {
+		lo, hi = min(lo, r.To), max(hi, r.To)
+	}
+	fmt.Fprintf(w, "并发数: 初始 %d，最小 %d，最大 %d，最终 %d，调整了 %d 次\n",
+		resizes[0].To, lo, hi, resizes[len(resizes)-1].To, len(resizes)-1)
+	changes := resizes[1:]
+	if len(changes) == 0 {
+		return
+	}
+	rows := changes
+	if len(changes) > maxTimelineRows {
+		rows = make([]checker.Resize, maxTimelineRows)
+		for i := range rows {
+			rows[i] = changes[i*(len(changes)-1)/(maxTimelineRows-1)]
+		}
+	}
+	for _, r := range rows {
+		fmt.Fprintf(w, "  %8s  %3d -> %-3d  %s\n", "+"+r.At.Round(time.Millisecond).String(), r.From, r.To, resizeReason(r))
+	}
+}
+
+// resizeReason 返回并发数变化的原因，用于显示
+func resizeReason(r checker.Resize) string {
+	switch r.Reason {
+	case checker.ResizeBusy:
+		return "worker 都在忙"
+	case checker.ResizeErrors:
+		return fmt.Sprintf("错误率 %.0f%%", r.ErrorRate*100)
+	case checker.ResizeLatency:
+		return fmt.Sprintf("平均延迟升高到 %v", r.Latency.Round(time.Millisecond))
+	}
+	return r.Reason
+}
+
+// TrippedHost 是一个熔断过的主机
+type TrippedHost struct {
+	Host      string
+	Trips     int    // 断开的次数
+	Skipped   int    // 跳过的目标数
+	Error     string // 最后一次连接失败的原因
+	Recovered bool   // 运行结束时是否已经恢复
+}
+
+// breakerLog 记录 -breaker 时每个主机的熔断情况。
+// OnChange 在 worker 的 goroutine 中调用，所以需要加锁
+type breakerLog struct {
+	mu    sync.Mutex
+	hosts map[string]*TrippedHost
+}
+
+// add 记录一次状态变化
+func (b *breakerLog) add(e checker.BreakerEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.hosts == nil {
+		b.hosts = make(map[string]*TrippedHost)
+	}
+	h, ok := b.hosts[e.Host]
+	if !ok {
+		h = &TrippedHost{Host: e.Host}
+		b.hosts[e.Host] = h
+	}
+	switch e.To {
+	case checker.BreakerOpen:
+		if e.From == checker.BreakerClosed {
+			h.Trips++
+		}
+		h.Recovered = false
+		if e.Error != nil {
+			h.Error = e.Error.Error()
+		}
+	case checker.BreakerClosed:
+		h.Recovered = true
+	}
+}
+
+// skip 统计一个被跳过的结果
+func (b *breakerLog) skip(res checker.Result) {
+	var hostDown *checker.HostDownError
+	if !errors.As(res.Error, &hostDown) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if h, ok := b.hosts[hostDown.Host]; ok {
+		h.Skipped++
+	}
+}
+
+// list 按主机名返回所有熔断过的主机
+func (b *breakerLog) list() []TrippedHost {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var hosts []TrippedHost
+	for _, h := range b.hosts {
+		hosts = append(hosts, *h)
+	}
+	slices.SortFunc(hosts, func(a, b TrippedHost) int { return strings.Compare(a.Host, b.Host) })
+	return hosts
+}
+
+// printTrippedHosts 输出熔断过的主机
+func printTrippedHosts(w io.Writer, hosts []TrippedHost) {
+	if len(hosts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "熔断的主机: %d\n", len(hosts))
+	for _, h := range hosts {
+		state := "未恢复"
+		if h.Recovered {
+			state = "已恢复"
+		}
+		fmt.Fprintf(w, "  %s: 断开 %d 次，跳过 %d 个目标，%s，最后一次错误: %s\n", h.Host, h.Trips, h.Skipped, state, h.Error)
+	}
+}
+
+// ReportWriter 把检查结果写成某种输出格式。
+// WriteResult 在每拿到一个结果时调用，结果应该尽快写出去而不是攒在内存里，
+// 这样目标列表再长也不会耗尽内存；Close 在所有结果都处理完之后调用一次，写出统计信息。
+type ReportWriter interface {
+	WriteResult(res checker.Result) error
+	Close(s Summary) error
+}
+
+// newReportWriter 根据 -output 参数创建对应的 ReportWriter
+func newReportWriter(format string, out io.Writer) (ReportWriter, error) {
+	switch format {
+	case "text":
+		return &textWriter{out: out}, nil
+	case "json":
+		return &jsonWriter{out: out}, nil
+	case "ndjson":
+		return &ndjsonWriter{enc: json.NewEncoder(out)}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(out)}, nil
+	case "junit":
+		return &junitWriter{out: out}, nil
+	}
+	return nil, fmt.Errorf("不支持的输出格式 %q，可选 text、json、ndjson、csv、junit", format)
+}
+
+// teeWriter 把结果同时交给多个 ReportWriter，比如 -html 在 -output 的报告之外再写一份 HTML
+type teeWriter []ReportWriter
+
+func (t teeWriter) WriteResult(res checker.Result) error {
+	for _, w := range t {
+		if err := w.WriteResult(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 关闭所有的 ReportWriter，一个出错了也要关闭其他的
+func (t teeWriter) Close(s Summary) error {
+	var errs []error
+	for _, w := range t {
+		errs = append(errs, w.Close(s))
+	}
+	return errors.Join(errs...)
+}
+
+// arrangeReport 按照 -order 和 -sort 参数包装 w，调整结果交给它的顺序。
+// 排序时相同的结果本来就按输入顺序排列，所以 -sort 会覆盖 -order
+func arrangeReport(w ReportWriter, order, sortBy string) (ReportWriter, error) {
+	if order != "completion" && order != "input" {
+		return nil, fmt.Errorf("不支持的输出顺序 %q，可选 completion、input", order)
+	}
+	if sortBy != "" {
+		cmp, ok := resultOrders[sortBy]
+		if !ok {
+			return nil, fmt.Errorf("不支持的排序方式 %q，可选 latency、status、name", sortBy)
+		}
+		return &sortedWriter{next: w, cmp: cmp}, nil
+	}
+	if order == "input" {
+		return &orderedWriter{next: w, pending: make(map[int]checker.Result), window: make(chan struct{}, orderWindow)}, nil
+	}
+	return w, nil
+}
+
+// orderWindow 是 -order input 时最多分发出去、还没写出的目标数，也就是 pending 最多暂存的结果数
+const orderWindow = 10000
+
+// orderedWriter 按 Seq 的顺序把结果交给 next。先完成的结果暂存在 pending 中，
+// 等排在前面的结果都到了再一起写出，所以暂存的只是还没检查完的目标后面那些结果。
+// 排在前面的目标一直没有结果（如很慢的超时）时，暂存的结果会越来越多，
+// 所以分发目标之前要调用 admit，最多领先最早没写出的目标 orderWindow 个。
+type orderedWriter struct {
+	next    ReportWriter
+	pending map[int]checker.Result
+	seq     int           // 下一个要写出的序号
+	window  chan struct{} // 每个分发出去、还没写出的目标占一个位置
+}
+
+// admit 在分发一个目标之前调用，window 满了时等到最早的结果写出。
+// ctx 被取消之后不再等待：剩下的目标会很快返回被取消的结果，写报告出错时也不会再写出结果
+func (o *orderedWriter) admit(ctx context.Context) {
+	select {
+	case o.window <- struct{}{}:
+	case <-ctx.Done():
+	}
+}
+
+func (o *orderedWriter) WriteResult(res checker.Result) error {
+	o.pending[res.Seq] = res
+	for {
+		next, ok := o.pending[o.seq]
+		if !ok {
+			return nil
+		}
+		delete(o.pending, o.seq)
+		o.seq++
+		select {
+		case <-o.window:
+		default: // 没有经过 admit 的结果，如取消之后分发的目标
+		}
+		if err := o.next.WriteResult(next); err != nil {
+			return err
+		}
+	}
+}
+
+func (o *orderedWriter) Close(s Summary) error {
+	// 每个目标都会有结果，正常情况下这里已经没有剩下的了，为了不丢结果还是按顺序写出
+	for _, seq := range slices.Sorted(maps.Keys(o.pending)) {
+		if err := o.next.WriteResult(o.pending[seq]); err != nil {
+			return err
+		}
+	}
+	return o.next.Close(s)
+}
+
+// resultOrders 是 -sort 支持的排序方式，相同时按输入顺序
+var resultOrders = map[string]func(a, b checker.Result) int{
+	"latency": func(a, b checker.Result) int {
+		return cmp.Or(cmp.Compare(b.Latency, a.Latency), cmp.Compare(a.Seq, b.Seq))
+	},
+	// 失败的在前，然后是带警告的，最后是成功的，同一类中按状态码排序
+	"status": func(a, b checker.Result) int {
+		return cmp.Or(cmp.Compare(statusRank(a), statusRank(b)), cmp.Compare(a.StatusCode, b.StatusCode), cmp.Compare(a.Seq, b.Seq))
+	},
+	"name": func(a, b checker.Result) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.URL, b.URL), cmp.Compare(a.Seq, b.Seq))
+	},
+}
+
+// statusRank 返回按状态排序时的先后：失败 0，警告 1，成功 2
+func statusRank(res checker.Result) int {
+	switch {
+	case !res.OK():
+		return 0
+	case res.Warn():
+		return 1
+	}
+	return 2
+}
+
+// sortedWriter 收齐所有结果之后排好序再交给 next。
+// 排序必须看到全部结果，所以这是唯一会把结果都留在内存里的输出方式。
+type sortedWriter struct {
+	next    ReportWriter
+	cmp     func(a, b checker.Result) int
+	results []checker.Result
+}
+
+func (w *sortedWriter) WriteResult(res checker.Result) error {
+	w.results = append(w.results, res)
+	return nil
+}
+
+func (w *sortedWriter) Close(s Summary) error {
+	slices.SortFunc(w.results, w.cmp)
+	for _, res := range w.results {
+		if err := w.next.WriteResult(res); err != nil {
+			return err
+		}
+	}
+	return w.next.Close(s)
+}
+
+// nameText 返回表格中名称一列的内容，旧的 urls.txt 格式没有名称
+func nameText(res checker.Result) string {
+	if res.Name == "" {
+		return "-"
+	}
+	return res.Name
+}
+
+// errorText 返回表格中错误一列的内容，经过重试的结果会注明重试情况
+func errorText(res checker.Result) string {
+	var text string
+	switch {
+	case res.Error != nil:
+		text = res.Error.Error()
+	case len(res.Failures) > 0:
+		text = "断言失败: " + strings.Join(res.Failures, "; ")
+	case res.Warn():
+		text = "警告: " + strings.Join(res.Warnings, "; ")
+		if res.Retried() {
+			text += fmt.Sprintf("（第 %d 次尝试成功）", res.Attempts)
+		}
+		return text
+	case res.Retried():
+		return fmt.Sprintf("N/A（第 %d 次尝试成功）", res.Attempts)
+	default:
+		return "N/A"
+	}
+	if res.Retried() {
+		text = fmt.Sprintf("重试 %d 次后仍失败: %s", res.Attempts-1, text)
+	}
+	return text
+}
+
+// statusText 返回表格中状态码一列的内容，非 HTTP 检查没有状态码
+func statusText(res checker.Result) string {
+	if res.StatusCode == 0 {
+		return "N/A"
+	}
+	return fmt.Sprint(res.StatusCode)
+}
+
+// timingText 返回表格中各阶段耗时的五列（用 \t 分隔），非 HTTP 检查显示 -
+func timingText(res checker.Result) string {
+	t := res.Timing
+	if t == nil {
+		return "-\t-\t-\t-\t-"
+	}
+	return fmt.Sprintf("%v\t%v\t%v\t%v\t%v", t.DNS, t.Connect, t.TLS, t.TTFB, t.Download)
+}
+
+// redirectChainText 把重定向链显示成 "url (301, 12ms) → url (200, 30ms)" 的形式
+func redirectChainText(hops []checker.Hop) string {
+	parts := make([]string, len(hops))
+	for i, h := range hops {
+		status := "N/A"
+		if h.StatusCode != 0 {
+			status = fmt.Sprint(h.StatusCode)
+		}
+		parts[i] = fmt.Sprintf("%s (%s, %v)", h.URL, status, h.Latency.Round(time.Microsecond))
+	}
+	return strings.Join(parts, " → ")
+}
+
+// textWriter 是默认的输出格式：tabwriter 表格加统计信息。
+// 表格每 textBlockRows 行输出一次（-stream 时每行都输出），同一块中的列是对齐的；
+// 重定向链和失效链接要在表格之后列出，只保留需要列出的那些结果。
+type textWriter struct {
+	out       io.Writer
+	table     *tabwriter.Writer
+	rows      int
+	redirects []checker.Result // -v 时发生了重定向的结果
+	broken    []checker.Result // 爬取模式下失效的链接
+}
+
+// textBlockRows 是表格每次输出的行数
+const textBlockRows = 100
+
+// header 在第一次使用时创建表格并写出表头
+func (t *textWriter) header() *tabwriter.Writer {
+	if t.table == nil {
+		// 使用 tabwriter 格式化输出
+		t.table = tabwriter.NewWriter(t.out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		fmt.Fprintln(t.table, "Name\tURL\tKind\tStatusCode\tLatency\tDNS\tConnect\tTLS\tTTFB\tDownload\tError\t")
+		fmt.Fprintln(t.table, "----\t---\t----\t----------\t-------\t---\t-------\t---\t----\t--------\t-----\t")
+	}
+	return t.table
+}
+
+func (t *textWriter) WriteResult(res checker.Result) error {
+	t.header()
+	if res.Error != nil {
+		fmt.Fprintf(t.table, "%s\t%s\t%s\tN/A\tN/A\t%s\t%s\t\n", nameText(res), res.URL, res.Kind, timingText(res), errorText(res))
+	} else {
+		fmt.Fprintf(t.table, "%s\t%s\t%s\t%s\t%v\t%s\t%s\t\n", nameText(res), res.URL, res.Kind, statusText(res), res.Latency, timingText(res), errorText(res))
+	}
+	if verbose && len(res.Hops) > 1 {
+		t.redirects = append(t.redirects, res)
+	}
+	if !res.OK() && res.FoundOn != "" && res.Category() != checker.CategoryCanceled {
+		t.broken = append(t.broken, res)
+	}
+	if t.rows++; streamOutput || t.rows%textBlockRows == 0 {
+		return t.table.Flush()
+	}
+	return nil
+}
+
+func (t *textWriter) Close(s Summary) error {
+	if err := t.header().Flush(); err != nil { // 不要忘记 Flush
+		return err
+	}
+
+	// -v 时列出所有发生了重定向的目标的完整重定向链
+	if len(t.redirects) > 0 {
+		fmt.Fprintln(t.out, "\n--- 重定向链 ---")
+		for _, res := range t.redirects {
+			fmt.Fprintf(t.out, "%s: %s\n", resultKey(res), redirectChainText(res.Hops))
+		}
+	}
+
+	// 爬取模式下列出失效的链接以及它们出现在哪个页面
+	if len(t.broken) > 0 {
+		fmt.Fprintln(t.out, "\n--- 失效链接 ---")
+		for _, res := range t.broken {
+			fmt.Fprintf(t.out, "%s: %s\n    出现在 %s\n", res.URL, errorText(res), res.FoundOn)
+		}
+	}
+
+	// 打印统计信息
+	fmt.Fprintln(t.out, "\n--- 统计信息 ---")
+	fmt.Fprintf(t.out, "总计URL数量: %d\n", s.Total)
+	fmt.Fprintf(t.out, "成功数量: %d\n", s.Success)
+	fmt.Fprintf(t.out, "失败数量: %d\n", s.Fail)
+	if s.Warn > 0 {
+		fmt.Fprintf(t.out, "警告数量: %d\n", s.Warn)
+	}
+	if s.Canceled > 0 {
+		fmt.Fprintf(t.out, "已取消: %d（报告不完整）\n", s.Canceled)
+	}
+	if s.Skipped > 0 {
+		fmt.Fprintf(t.out, "主机不可用而跳过: %d\n", s.Skipped)
+	}
+	if s.PassedOnRetry > 0 || s.FailedAfterRetry > 0 {
+		fmt.Fprintf(t.out, "重试后成功: %d\n", s.PassedOnRetry)
+		fmt.Fprintf(t.out, "重试后仍失败: %d\n", s.FailedAfterRetry)
+	}
+	if s.Success > 0 {
+		l := s.Latency
+		fmt.Fprintf(t.out, "平均延迟: %v\n", s.AvgLatency)
+		fmt.Fprintf(t.out, "最小/最大延迟: %v / %v\n", l.Min, l.Max)
+		fmt.Fprintf(t.out, "延迟标准差: %v\n", l.StdDev)
+		fmt.Fprintf(t.out, "P50/P90/P95/P99: %v / %v / %v / %v\n", l.P50, l.P90, l.P95, l.P99)
+		fmt.Fprintln(t.out, "延迟分布:")
+		printHistogram(t.out, s.Histogram)
+	}
+	printConcurrency(t.out, s.Concurrency)
+	printTrippedHosts(t.out, s.TrippedHosts)
+	_, err := fmt.Fprintln(t.out, "-----------------")
+	return err
+}
+
+// resultRecord 是 Result 在结构化输出中的样子。
+// error 本身没法直接序列化成 JSON，所以转换成字符串和错误类别。
+type resultRecord struct {
+	Name          string        `json:"name,omitempty"`
+	URL           string        `json:"url"`
+	Kind          string        `json:"kind"`
+	Tags          []string      `json:"tags,omitempty"`
+	OK            bool          `json:"ok"`
+	State         State         `json:"state"` // UP、WARN 或 DOWN
+	StatusCode    int           `json:"status_code,omitempty"`
+	LatencyMS     float64       `json:"latency_ms"`
+	Detail        string        `json:"detail,omitempty"`
+	Timing        *timingRecord `json:"timing,omitempty"`
+	FinalURL      string        `json:"final_url,omitempty"` // 只有发生了重定向才有
+	Redirects     []hopRecord   `json:"redirects,omitempty"` // 完整的重定向链，包括最后一跳
+	Cert          *certRecord   `json:"cert,omitempty"`
+	FoundOn       string        `json:"found_on,omitempty"` // 爬取模式下发现这个链接的页面
+	Failures      []string      `json:"failures,omitempty"`
+	Warnings      []string      `json:"warnings,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	ErrorCategory string        `json:"error_category,omitempty"`
+	Attempts      int           `json:"attempts"`
+	AttemptErrors []string      `json:"attempt_errors,omitempty"`
+}
+
+// timingRecord 是 PhaseTiming 在结构化输出中的样子，单位都是毫秒
+type timingRecord struct {
+	DNSMS      float64 `json:"dns_ms"`
+	ConnectMS  float64 `json:"connect_ms"`
+	TLSMS      float64 `json:"tls_ms"`
+	TTFBMS     float64 `json:"ttfb_ms"`
+	DownloadMS float64 `json:"download_ms"`
+}
+
+// hopRecord 是重定向链中的一跳
+type hopRecord struct {
+	URL        string  `json:"url"`
+	StatusCode int     `json:"status_code,omitempty"`
+	LatencyMS  float64 `json:"latency_ms"`
+}
+
+// certRecord 是 CertInfo 在结构化输出中的样子，时间使用 RFC 3339 格式
+type certRecord struct {
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	DNSNames      []string  `json:"dns_names,omitempty"`
+	NotBefore     time.Time `json:"not_before"`
+	NotAfter      time.Time `json:"not_after"`
+	ChainExpiry   time.Time `json:"chain_expiry"`
+	DaysLeft      int       `json:"days_left"` // 距离 chain_expiry 还有多少天
+	HostnameMatch bool      `json:"hostname_match"`
+}
+
+func newResultRecord(res checker.Result) resultRecord {
+	r := resultRecord{
+		Name:          res.Name,
+		URL:           res.URL,
+		Kind:          res.Kind,
+		Tags:          res.Tags,
+		OK:            res.OK(),
+		State:         stateOf(res),
+		StatusCode:    res.StatusCode,
+		LatencyMS:     milliseconds(res.Latency),
+		Detail:        res.Detail,
+		FoundOn:       res.FoundOn,
+		Failures:      res.Failures,
+		Warnings:      res.Warnings,
+		ErrorCategory: res.Category(),
+		Attempts:      res.Attempts,
+	}
+	if t := res.Timing; t != nil {
+		r.Timing = &timingRecord{
+			DNSMS:      milliseconds(t.DNS),
+			ConnectMS:  milliseconds(t.Connect),
+			TLSMS:      milliseconds(t.TLS),
+			TTFBMS:     milliseconds(t.TTFB),
+			DownloadMS: milliseconds(t.Download),
+		}
+	}
+	if len(res.Hops) > 1 {
+		r.FinalURL = res.Hops[len(res.Hops)-1].URL
+		for _, h := range res.Hops {
+			r.Redirects = append(r.Redirects, hopRecord{URL: h.URL, StatusCode: h.StatusCode, LatencyMS: milliseconds(h.Latency)})
+		}
+	}
+	if c := res.Cert; c != nil {
+		r.Cert = &certRecord{
+			Subject:       c.Subject,
+			Issuer:        c.Issuer,
+			DNSNames:      c.DNSNames,
+			NotBefore:     c.NotBefore,
+			NotAfter:      c.NotAfter,
+			ChainExpiry:   c.ChainExpiry,
+			DaysLeft:      int(time.Until(c.ChainExpiry) / (24 * time.Hour)),
+			HostnameMatch: c.HostnameMatch,
+		}
+	}
+	if res.Error != nil {
+		r.Error = res.Error.Error()
+	}
+	for _, err := range res.AttemptErrors {
+		r.AttemptErrors = append(r.AttemptErrors, err.Error())
+	}
+	return r
+}
+
+// summaryRecord 是 Summary 在结构化输出中的样子
+type summaryRecord struct {
+	Total            int             `json:"total"`
+	Success          int             `json:"success"`
+	Fail             int             `json:"fail"`
+	Warn             int             `json:"warn"`
+	Canceled         int             `json:"canceled"`
+	Skipped          int             `json:"skipped"`
+	PassedOnRetry    int             `json:"passed_on_retry"`
+	FailedAfterRetry int             `json:"failed_after_retry"`
+	AvgLatencyMS     float64         `json:"avg_latency_ms"`
+	Latency          *latencyRecord  `json:"latency,omitempty"`
+	Histogram        []bucketRecord  `json:"histogram,omitempty"`
+	Concurrency      []resizeRecord  `json:"concurrency,omitempty"`
+	TrippedHosts     []trippedRecord `json:"tripped_hosts,omitempty"`
+}
+
+// trippedRecord 是 TrippedHost 在结构化输出中的样子
+type trippedRecord struct {
+	Host      string `json:"host"`
+	Trips     int    `json:"trips"`
+	Skipped   int    `json:"skipped"`
+	Error     string `json:"error"`
+	Recovered bool   `json:"recovered"`
+}
+
+// resizeRecord 是 checker.Resize 在结构化输出中的样子
+type resizeRecord struct {
+	AtMS      float64 `json:"at_ms"`
+	From      int     `json:"from"`
+	To        int     `json:"to"`
+	Reason    string  `json:"reason"`
+	Completed int     `json:"completed"`
+	ErrorRate float64 `json:"error_rate"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// latencyRecord 是 LatencyStats 在结构化输出中的样子，单位都是毫秒
+type latencyRecord struct {
+	MinMS    float64 `json:"min_ms"`
+	MaxMS    float64 `json:"max_ms"`
+	MeanMS   float64 `json:"mean_ms"`
+	StdDevMS float64 `json:"stddev_ms"`
+	P50MS    float64 `json:"p50_ms"`
+	P90MS    float64 `json:"p90_ms"`
+	P95MS    float64 `json:"p95_ms"`
+	P99MS    float64 `json:"p99_ms"`
+}
+
+// bucketRecord 是直方图的一个桶，le_ms 为 null 表示 +Inf
+type bucketRecord struct {
+	LEMS  *float64 `json:"le_ms"`
+	Count int      `json:"count"`
+}
+
+func newSummaryRecord(s Summary) summaryRecord {
+	r := summaryRecord{
+		Total:            s.Total,
+		Success:          s.Success,
+		Fail:             s.Fail,
+		Warn:             s.Warn,
+		Canceled:         s.Canceled,
+		Skipped:          s.Skipped,
+		PassedOnRetry:    s.PassedOnRetry,
+		FailedAfterRetry: s.FailedAfterRetry,
+		AvgLatencyMS:     milliseconds(s.AvgLatency),
+	}
+	r.Latency = newLatencyRecord(s.Latency)
+	for _, b := range s.Histogram {
+		rec := bucketRecord{Count: b.Count}
+		if b.LE > 0 {
+			le := milliseconds(b.LE)
+			rec.LEMS = &le
+		}
+		r.Histogram = append(r.Histogram, rec)
+	}
+	for _, c := range s.Concurrency {
+		r.Concurrency = append(r.Concurrency, resizeRecord{
+			AtMS: milliseconds(c.At), From: c.From, To: c.To, Reason: c.Reason,
+			Completed: c.Completed, ErrorRate: c.ErrorRate, LatencyMS: milliseconds(c.Latency),
+		})
+	}
+	for _, h := range s.TrippedHosts {
+		r.TrippedHosts = append(r.TrippedHosts, trippedRecord(h))
+	}
+	return r
+}
+
+// newLatencyRecord 转换延迟统计值，没有数据时返回 nil
+func newLatencyRecord(l LatencyStats) *latencyRecord {
+	if l.Count == 0 {
+		return nil
+	}
+	return &latencyRecord{
+		MinMS:    milliseconds(l.Min),
+		MaxMS:    milliseconds(l.Max),
+		MeanMS:   milliseconds(l.Mean),
+		StdDevMS: milliseconds(l.StdDev),
+		P50MS:    milliseconds(l.P50),
+		P90MS:    milliseconds(l.P90),
+		P95MS:    milliseconds(l.P95),
+		P99MS:    milliseconds(l.P99),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// jsonWriter 输出一个完整的 JSON 报告。结果数组边收边写，
+// 统计信息在最后写出，所以报告的格式和一次性 Marshal 出来的一样。
+type jsonWriter struct {
+	out     io.Writer
+	started bool
+}
+
+func (j *jsonWriter) WriteResult(res checker.Result) error {
+	data, err := json.MarshalIndent(newResultRecord(res), "    ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n    "
+	if !j.started {
+		sep = "{\n  \"results\": [\n    "
+		j.started = true
+	}
+	_, err = fmt.Fprintf(j.out, "%s%s", sep, data)
+	return err
+}
+
+func (j *jsonWriter) Close(s Summary) error {
+	data, err := json.MarshalIndent(newSummaryRecord(s), "  ", "  ")
+	if err != nil {
+		return err
+	}
+	end := "\n  ],"
+	if !j.started {
+		end = "{\n  \"results\": [],"
+	}
+	_, err = fmt.Fprintf(j.out, "%s\n  \"summary\": %s\n}\n", end, data)
+	return err
+}
+
+// ndjsonWriter 每拿到一个结果就输出一行 JSON，最后一行是统计信息，
+// 用 type 字段区分两种记录
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) WriteResult(res checker.Result) error {
+	return n.enc.Encode(struct {
+		Type string `json:"type"`
+		resultRecord
+	}{"result", newResultRecord(res)})
+}
+
+func (n *ndjsonWriter) Close(s Summary) error {
+	return n.enc.Encode(struct {
+		Type string `json:"type"`
+		summaryRecord
+	}{"summary", newSummaryRecord(s)})
+}
+
+// csvWriter 每个结果输出一行，第一行是表头
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+var csvHeader = []string{"name", "url", "kind", "tags", "ok", "status_code", "latency_ms", "detail", "failures", "error", "error_category", "attempts",
+	"dns_ms", "connect_ms", "tls_ms", "ttfb_ms", "download_ms", "state", "warnings", "cert_expiry", "final_url", "found_on"}
+
+func (c *csvWriter) WriteResult(res checker.Result) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	r := newResultRecord(res)
+	status := ""
+	if r.StatusCode != 0 {
+		status = strconv.Itoa(r.StatusCode)
+	}
+	phases := make([]string, 5) // 非 HTTP 检查留空
+	if t := r.Timing; t != nil {
+		for i, ms := range []float64{t.DNSMS, t.ConnectMS, t.TLSMS, t.TTFBMS, t.DownloadMS} {
+			phases[i] = strconv.FormatFloat(ms, 'f', 3, 64)
+		}
+	}
+	certExpiry := ""
+	if r.Cert != nil {
+		certExpiry = r.Cert.ChainExpiry.Format(time.RFC3339)
+	}
+	row := append([]string{
+		r.Name, r.URL, r.Kind, strings.Join(r.Tags, ";"), strconv.FormatBool(r.OK), status,
+		strconv.FormatFloat(r.LatencyMS, 'f', 3, 64), r.Detail, strings.Join(r.Failures, "; "), r.Error, r.ErrorCategory,
+		strconv.Itoa(r.Attempts),
+	}, phases...)
+	err := c.w.Write(append(row, string(r.State), strings.Join(r.Warnings, "; "), certExpiry, r.FinalURL, r.FoundOn))
+	c.w.Flush()
+	if err != nil {
+		return err
+	}
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close(Summary) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// junitWriter 输出 JUnit XML，每个目标是一个 testcase，CI 系统可以直接展示。
+// testsuite 的属性里要写总数，只能在最后写出，所以 testcase 先写到一个临时文件里，
+// Close 时再拼到 testsuite 中，内存中不保存结果。
+type junitWriter struct {
+	out   io.Writer
+	cases *os.File
+	total time.Duration
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Props    []junitProperty `xml:"properties>property"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	XMLName   xml.Name      `xml:"testcase"`
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"` // JUnit 没有“警告”的概念，警告写在这里
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (j *junitWriter) WriteResult(res checker.Result) error {
+	if j.cases == nil {
+		f, err := os.CreateTemp("", "go-checker-junit-*.xml")
+		if err != nil {
+			return err
+		}
+		j.cases = f
+	}
+	j.total += res.Latency
+	tc := junitTestCase{
+		Name:      res.URL,
+		ClassName: "go-checker." + res.Kind,
+		Time:      seconds(res.Latency),
+	}
+	if res.Name != "" {
+		tc.Name = res.Name + " (" + res.URL + ")"
+	}
+	if !res.OK() {
+		tc.Failure = &junitFailure{Message: errorText(res), Type: res.Category(), Text: errorText(res)}
+	}
+	if res.Warn() {
+		tc.SystemOut = errorText(res)
+	}
+	data, err := xml.MarshalIndent(tc, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.cases, "%s\n", data)
+	return err
+}
+
+func (j *junitWriter) Close(s Summary) error {
+	if j.cases != nil {
+		defer os.Remove(j.cases.Name())
+		defer j.cases.Close()
+	}
+	// 除了 testcase 之外的部分照常用 junitTestSuite 生成，再在结束标签之前插入 testcase
+	suite := junitTestSuite{
+		Name:     "go-checker",
+		Tests:    s.Total,
+		Failures: s.Fail,
+		Time:     seconds(j.total),
+		Props: []junitProperty{
+			{"success", strconv.Itoa(s.Success)},
+			{"warn", strconv.Itoa(s.Warn)},
+			{"canceled", strconv.Itoa(s.Canceled)},
+			{"skipped", strconv.Itoa(s.Skipped)},
+			{"passed_on_retry", strconv.Itoa(s.PassedOnRetry)},
+			{"failed_after_retry", strconv.Itoa(s.FailedAfterRetry)},
+			{"avg_latency_ms", formatMS(s.AvgLatency)},
+			{"p50_latency_ms", formatMS(s.Latency.P50)},
+			{"p90_latency_ms", formatMS(s.Latency.P90)},
+			{"p95_latency_ms", formatMS(s.Latency.P95)},
+			{"p99_latency_ms", formatMS(s.Latency.P99)},
+		},
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	const endTag = "</testsuite>"
+	head := bytes.TrimSuffix(data, []byte(endTag))
+
+	if _, err := io.WriteString(j.out, xml.Header); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(j.out, "%s\n", bytes.TrimRight(head, "\n")); err != nil {
+		return err
+	}
+	if j.cases != nil {
+		if _, err := j.cases.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(j.out, j.cases); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(j.out, "%s\n", endTag)
+	return err
+}
+
+func formatMS(d time.Duration) string {
+	return strconv.FormatFloat(milliseconds(d), 'f', 3, 64)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
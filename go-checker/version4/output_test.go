@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// sampleResults 是输出测试共用的一组结果：一个成功，一个断言失败，一个连接被拒绝
+func sampleResults() []checker.Result {
+	return []checker.Result{
+		{Name: "首页", URL: "https://a.com", Kind: "http", StatusCode: 200, Latency: 100 * time.Millisecond, Tags: []string{"web"}},
+		{URL: "https://b.com", Kind: "http", StatusCode: 500, Latency: 50 * time.Millisecond, Failures: []string{"状态码 500 不在期望范围 [200-399] 内"}},
+		checker.CheckURL(context.Background(), "tcp://127.0.0.1:1"),
+	}
+}
+
+// summarize 像 main 中一样用 SummaryRecorder 统计所有结果
+func summarize(results []checker.Result) Summary {
+	var r SummaryRecorder
+	for _, res := range results {
+		r.Add(res)
+	}
+	return r.Summary()
+}
+
+func TestSummarize(t *testing.T) {
+	s := summarize(sampleResults())
+	if s.Total != 3 || s.Success != 1 || s.Fail != 2 {
+		t.Errorf("统计错误: %+v", s)
+	}
+	if s.AvgLatency != 100*time.Millisecond {
+		t.Errorf("期望平均延迟只统计成功的检查, 但得到了 %v", s.AvgLatency)
+	}
+}
+
+// writeReport 按照 main 中的调用顺序驱动一个 ReportWriter
+func writeReport(t *testing.T, format string, results []checker.Result) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newReportWriter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if err := w.WriteResult(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(summarize(results)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestJSONWriter(t *testing.T) {
+	var report struct {
+		Results []resultRecord `json:"results"`
+		Summary summaryRecord  `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(writeReport(t, "json", sampleResults())), &report); err != nil {
+		t.Fatalf("输出不是合法的 JSON: %v", err)
+	}
+	if len(report.Results) != 3 || report.Summary.Fail != 2 {
+		t.Errorf("JSON 报告内容错误: %+v", report)
+	}
+	if got := report.Results[2]; got.Error == "" || got.ErrorCategory != checker.CategoryRefused {
+		t.Errorf("期望错误被序列化为字符串和类别, 但得到了 %+v", got)
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(writeReport(t, "ndjson", sampleResults())))
+	var types []string
+	for scanner.Scan() {
+		var rec struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("第 %d 行不是合法的 JSON: %v", len(types)+1, err)
+		}
+		types = append(types, rec.Type)
+	}
+	if strings.Join(types, ",") != "result,result,result,summary" {
+		t.Errorf("期望三行结果和一行统计, 但得到了 %v", types)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(writeReport(t, "csv", sampleResults()))).ReadAll()
+	if err != nil {
+		t.Fatalf("输出不是合法的 CSV: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("期望表头加三行结果, 但得到了 %d 行", len(rows))
+	}
+	if rows[1][0] != "首页" || rows[1][4] != "true" || rows[2][10] != checker.CategoryAssertion {
+		t.Errorf("CSV 内容错误: %v", rows)
+	}
+}
+
+func TestJUnitWriter(t *testing.T) {
+	var suite junitTestSuite
+	if err := xml.Unmarshal([]byte(writeReport(t, "junit", sampleResults())), &suite); err != nil {
+		t.Fatalf("输出不是合法的 XML: %v", err)
+	}
+	if suite.Tests != 3 || suite.Failures != 2 || len(suite.Cases) != 3 {
+		t.Errorf("JUnit 统计错误: %+v", suite)
+	}
+	if suite.Cases[0].Failure != nil || suite.Cases[1].Failure == nil {
+		t.Errorf("期望只有失败的目标带 failure 元素")
+	}
+}
+
+func TestUnknownOutputFormat(t *testing.T) {
+	if _, err := newReportWriter("yaml", &bytes.Buffer{}); err == nil {
+		t.Error("期望不支持的格式返回错误，但没有得到")
+	}
+}
+
+func TestErrorTextRetried(t *testing.T) {
+	passed := checker.Result{StatusCode: 200, Attempts: 3}
+	if got := errorText(passed); !strings.Contains(got, "第 3 次尝试成功") {
+		t.Errorf("期望报告注明重试后成功, 但得到了 %q", got)
+	}
+	failed := checker.Result{Error: errors.New("connection refused"), Attempts: 3}
+	if got := errorText(failed); !strings.HasPrefix(got, "重试 2 次后仍失败") {
+		t.Errorf("期望报告注明重试后仍失败, 但得到了 %q", got)
+	}
+	if s := summarize([]checker.Result{passed, failed}); s.PassedOnRetry != 1 || s.FailedAfterRetry != 1 {
+		t.Errorf("期望统计到重试后成功和失败各 1 个, 但得到了 %+v", s)
+	}
+}
+
+func TestTimingOutput(t *testing.T) {
+	res := checker.Result{Kind: "http", StatusCode: 200, Timing: &checker.PhaseTiming{TTFB: 50 * time.Millisecond}}
+	var rec resultRecord
+	if err := json.Unmarshal([]byte(mustJSON(t, newResultRecord(res))), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Timing == nil || rec.Timing.TTFBMS != 50 {
+		t.Errorf("期望结构化输出包含 timing, 但得到了 %+v", rec.Timing)
+	}
+
+	res = checker.Result{Kind: "tcp"}
+	if got := timingText(res); got != "-\t-\t-\t-\t-" {
+		t.Errorf("期望非 HTTP 检查的阶段耗时显示为 -, 但得到了 %q", got)
+	}
+	if strings.Contains(mustJSON(t, newResultRecord(res)), "timing") {
+		t.Error("期望非 HTTP 检查的结构化输出不包含 timing")
+	}
+}
+
+func TestRedirectOutput(t *testing.T) {
+	res := checker.Result{URL: "http://a.com/old", Kind: "http", StatusCode: 200, Hops: []checker.Hop{
+		{URL: "http://a.com/old", StatusCode: 301, Latency: time.Millisecond},
+		{URL: "http://a.com/mid", StatusCode: 302, Latency: time.Millisecond},
+		{URL: "http://a.com/new", StatusCode: 200, Latency: time.Millisecond},
+	}}
+	rec := newResultRecord(res)
+	if rec.FinalURL != "http://a.com/new" || len(rec.Redirects) != 3 {
+		t.Errorf("结构化输出中的重定向链错误: %s %v", rec.FinalURL, rec.Redirects)
+	}
+
+	verbose = true
+	defer func() { verbose = false }()
+	if out := writeReport(t, "text", []checker.Result{res}); !strings.Contains(out, "重定向链") || !strings.Contains(out, "/old (301") {
+		t.Errorf("期望 -v 时输出重定向链, 但得到了:\n%s", out)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// recordWriter 记录交给它的结果，用来检查包装的 ReportWriter 调整后的顺序
+type recordWriter struct {
+	names  []string
+	closed bool
+}
+
+func (r *recordWriter) WriteResult(res checker.Result) error {
+	r.names = append(r.names, res.Name)
+	return nil
+}
+
+func (r *recordWriter) Close(Summary) error {
+	r.closed = true
+	return nil
+}
+
+func TestArrangeReport(t *testing.T) {
+	// 按完成的顺序到达：Seq 2、0、3、1
+	arrived := []checker.Result{
+		{Seq: 2, Name: "c", StatusCode: 200, Latency: 30 * time.Millisecond},
+		{Seq: 0, Name: "a", StatusCode: 200, Latency: 10 * time.Millisecond, Warnings: []string{"证书即将过期"}},
+		{Seq: 3, Name: "d", StatusCode: 500, Latency: 30 * time.Millisecond, Failures: []string{"状态码不对"}},
+		{Seq: 1, Name: "b", StatusCode: 404, Latency: 20 * time.Millisecond, Failures: []string{"状态码不对"}},
+	}
+	tests := []struct {
+		order, sortBy string
+		want          string
+	}{
+		{"completion", "", "c,a,d,b"},
+		{"input", "", "a,b,c,d"},
+		{"completion", "latency", "c,d,b,a"}, // 延迟相同的 c 和 d 按输入顺序
+		{"completion", "status", "b,d,a,c"},
+		{"input", "name", "a,b,c,d"},
+	}
+	for _, tc := range tests {
+		rec := &recordWriter{}
+		w, err := arrangeReport(rec, tc.order, tc.sortBy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, res := range arrived {
+			if err := w.WriteResult(res); err != nil {
+				t.Fatal(err)
+			}
+			// 按输入顺序输出时，a 到了之后 a 马上写出，b 到了之后 b、c、d 一起写出
+			if tc.order == "input" && tc.sortBy == "" && i == 1 && strings.Join(rec.names, ",") != "a" {
+				t.Errorf("期望前面的结果到齐后立即写出, 但得到了 %v", rec.names)
+			}
+		}
+		if err := w.Close(summarize(arrived)); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(rec.names, ","); got != tc.want || !rec.closed {
+			t.Errorf("-order %s -sort %s: 期望 %s, 但得到了 %s", tc.order, tc.sortBy, tc.want, got)
+		}
+	}
+
+	for _, args := range [][2]string{{"random", ""}, {"input", "size"}} {
+		if _, err := arrangeReport(&recordWriter{}, args[0], args[1]); err == nil {
+			t.Errorf("期望 -order %s -sort %s 报错, 但没有得到错误", args[0], args[1])
+		}
+	}
+}
+
+// 排在前面的结果没到时，最多领先 window 个目标，之后 admit 等到前面的结果写出
+func TestOrderedWriterWindow(t *testing.T) {
+	o := &orderedWriter{next: &recordWriter{}, pending: make(map[int]checker.Result), window: make(chan struct{}, 2)}
+	ctx := context.Background()
+	o.admit(ctx)
+	o.admit(ctx)
+	admitted := make(chan struct{})
+	go func() {
+		o.admit(ctx)
+		close(admitted)
+	}()
+
+	o.WriteResult(checker.Result{Seq: 1})
+	select {
+	case <-admitted:
+		t.Fatal("期望最早的结果没有写出时 admit 等待")
+	case <-time.After(20 * time.Millisecond):
+	}
+	o.WriteResult(checker.Result{Seq: 0})
+	select {
+	case <-admitted:
+	case <-time.After(time.Second):
+		t.Fatal("期望最早的结果写出之后 admit 返回")
+	}
+
+	// 被取消之后不再等待
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	o.admit(ctx)
+	o.admit(cctx)
+}
+
+func TestBreakerLog(t *testing.T) {
+	var b breakerLog
+	down := errors.New("connection refused")
+	b.add(checker.BreakerEvent{Host: "a.com", From: checker.BreakerClosed, To: checker.BreakerOpen, Failures: 3, Error: down})
+	b.add(checker.BreakerEvent{Host: "b.com", From: checker.BreakerClosed, To: checker.BreakerOpen, Failures: 3, Error: down})
+	b.add(checker.BreakerEvent{Host: "b.com", From: checker.BreakerOpen, To: checker.BreakerClosed})
+	skipped := checker.Result{URL: "https://a.com/x", Error: &checker.HostDownError{Host: "a.com", Failures: 3}}
+	results := []checker.Result{skipped, skipped, {URL: "https://a.com/y"}}
+	for _, res := range results {
+		b.skip(res)
+	}
+
+	hosts := b.list()
+	want := []TrippedHost{
+		{Host: "a.com", Trips: 1, Skipped: 2, Error: "connection refused"},
+		{Host: "b.com", Trips: 1, Error: "connection refused", Recovered: true},
+	}
+	if !slices.Equal(hosts, want) {
+		t.Errorf("期望 %+v, 但得到了 %+v", want, hosts)
+	}
+	s := summarize(results)
+	s.TrippedHosts = hosts
+	var buf bytes.Buffer
+	w, _ := newReportWriter("text", &buf)
+	if err := w.Close(s); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "主机不可用而跳过: 2") || !strings.Contains(out, "a.com: 断开 1 次，跳过 2 个目标，未恢复") {
+		t.Errorf("期望统计信息列出熔断的主机, 但得到了:\n%s", out)
+	}
+}
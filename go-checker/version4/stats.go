@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/bits"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LatencyStats 是一组延迟的统计值。平均值会掩盖长尾，
+// 所以还需要分位数：P99 表示 99% 的请求都比它快。
+type LatencyStats struct {
+	Count  int
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	StdDev time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+}
+
+// computeLatencyStats 计算一组延迟的统计值，不会修改传入的切片
+func computeLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	var sum float64
+	for _, d := range sorted {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(sorted))
+	var variance float64
+	for _, d := range sorted {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	variance /= float64(len(sorted))
+
+	return LatencyStats{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Mean:   time.Duration(mean),
+		StdDev: time.Duration(math.Sqrt(variance)),
+		P50:    percentile(sorted, 50),
+		P90:    percentile(sorted, 90),
+		P95:    percentile(sorted, 95),
+		P99:    percentile(sorted, 99),
+	}
+}
+
+// percentile 用最近秩（nearest-rank）方法计算分位数，sorted 必须已经排好序
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// LatencyRecorder 在线统计延迟：每来一个值就更新计数、均值和分桶，不保存原始数据，
+// 几千万个结果也只占用固定的内存。分位数从分桶估算，相对误差不超过 1/sketchSub（约 1.6%）。
+// 知识点：均值和方差用 Welford 算法增量计算，避免先求和再相减时的精度损失。
+type LatencyRecorder struct {
+	count    int
+	min, max time.Duration
+	mean, m2 float64 // m2 是与均值之差的平方和
+	sketch   map[int]int
+	buckets  []HistogramBucket // 按照 latencyBuckets 的边界统计，和 Prometheus 指标使用同样的桶
+}
+
+// sketchSub 是分位数估算时每个 2 的幂区间再细分的桶数
+const sketchSub = 64
+
+// sketchIndex 返回 d 所在的估算桶。小于 sketchSub 纳秒的值每个值一个桶，
+// 更大的值只保留最高的 7 个二进制位，所以桶的宽度和值本身成正比。
+func sketchIndex(d time.Duration) int {
+	v := uint64(max(d, 0))
+	if v < sketchSub {
+		return int(v)
+	}
+	shift := bits.Len64(v) - 7
+	return (shift+1)*sketchSub + int(v>>shift) - sketchSub
+}
+
+// sketchValue 返回估算桶的中间值，是 sketchIndex 的逆运算
+func sketchValue(i int) time.Duration {
+	if i < sketchSub {
+		return time.Duration(i)
+	}
+	shift := i/sketchSub - 1
+	low := uint64(i%sketchSub+sketchSub) << shift
+	return time.Duration(low + (uint64(1)<<shift)/2)
+}
+
+// Add 加入一个延迟
+func (r *LatencyRecorder) Add(d time.Duration) {
+	if r.count == 0 {
+		r.min, r.max = d, d
+		r.sketch = make(map[int]int)
+		r.buckets = make([]HistogramBucket, len(latencyBuckets)+1)
+		for i, le := range latencyBuckets {
+			r.buckets[i].LE = time.Duration(le * float64(time.Second))
+		}
+	}
+	r.count++
+	r.min, r.max = min(r.min, d), max(r.max, d)
+	delta := float64(d) - r.mean
+	r.mean += delta / float64(r.count)
+	r.m2 += delta * (float64(d) - r.mean)
+	r.sketch[sketchIndex(d)]++
+
+	i := len(latencyBuckets) // 默认落在 +Inf 桶
+	for j, b := range r.buckets[:len(latencyBuckets)] {
+		if d <= b.LE {
+			i = j
+			break
+		}
+	}
+	r.buckets[i].Count++
+}
+
+// Stats 返回目前为止的统计值，Min、Max、Mean、StdDev 是精确值，分位数是估算值
+func (r *LatencyRecorder) Stats() LatencyStats {
+	if r.count == 0 {
+		return LatencyStats{}
+	}
+	indexes := slices.Sorted(maps.Keys(r.sketch))
+	// 和 percentile 一样用最近秩方法，找到第 rank 个值所在的桶
+	quantile := func(p float64) time.Duration {
+		rank := max(int(math.Ceil(p/100*float64(r.count))), 1)
+		seen := 0
+		for _, i := range indexes {
+			if seen += r.sketch[i]; seen >= rank {
+				return min(max(sketchValue(i), r.min), r.max)
+			}
+		}
+		return r.max
+	}
+	return LatencyStats{
+		Count:  r.count,
+		Min:    r.min,
+		Max:    r.max,
+		Mean:   time.Duration(r.mean),
+		StdDev: time.Duration(math.Sqrt(r.m2 / float64(r.count))),
+		P50:    quantile(50),
+		P90:    quantile(90),
+		P95:    quantile(95),
+		P99:    quantile(99),
+	}
+}
+
+// Histogram 返回按 latencyBuckets 分桶的延迟分布，没有数据时返回 nil
+func (r *LatencyRecorder) Histogram() []HistogramBucket {
+	return slices.Clone(r.buckets)
+}
+
+// HistogramBucket 是直方图中的一个桶，统计延迟在 (上一个桶的 LE, LE] 之间的数量。
+// 最后一个桶的 LE 为 0，表示 +Inf。
+type HistogramBucket struct {
+	LE    time.Duration
+	Count int
+}
+
+// bucketLabel 返回桶的上界，用于显示
+func (b HistogramBucket) bucketLabel() string {
+	if b.LE == 0 {
+		return "+Inf"
+	}
+	return b.LE.String()
+}
+
+// printHistogram 在终端画出 ASCII 直方图，省略两端没有数据的桶
+func printHistogram(w io.Writer, buckets []HistogramBucket) {
+	first, last, peak := -1, -1, 0
+	for i, b := range buckets {
+		if b.Count > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			peak = max(peak, b.Count)
+		}
+	}
+	if first < 0 {
+		return
+	}
+
+	const width = 40
+	for _, b := range buckets[first : last+1] {
+		bar := strings.Repeat("#", (b.Count*width+peak-1)/peak) // 向上取整，有数据的桶至少一个 #
+		fmt.Fprintf(w, "  <= %-7s | %-*s %d\n", b.bucketLabel(), width, bar, b.Count)
+	}
+}
+
+// RollingWindow 保存最近 N 个延迟，监控模式下用它计算每个目标最近一段时间的分位数。
+// 知识点：用固定大小的环形缓冲区，新数据覆盖最旧的数据，内存不会随运行时间增长。
+type RollingWindow struct {
+	values []time.Duration
+	next   int  // 下一个写入的位置
+	full   bool // 缓冲区是否已经写满过一轮
+}
+
+func NewRollingWindow(size int) *RollingWindow {
+	return &RollingWindow{values: make([]time.Duration, max(size, 1))}
+}
+
+// Add 加入一个延迟，缓冲区满了会覆盖最旧的值
+func (r *RollingWindow) Add(d time.Duration) {
+	r.values[r.next] = d
+	r.next = (r.next + 1) % len(r.values)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Values 返回窗口中的所有延迟（不保证顺序）
+func (r *RollingWindow) Values() []time.Duration {
+	if r.full {
+		return slices.Clone(r.values)
+	}
+	return slices.Clone(r.values[:r.next])
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeLatencyStats(t *testing.T) {
+	// 1ms 到 100ms 各一个，打乱顺序传入
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	s := computeLatencyStats(latencies)
+
+	want := LatencyStats{
+		Count: 100,
+		Min:   time.Millisecond,
+		Max:   100 * time.Millisecond,
+		Mean:  50500 * time.Microsecond,
+		P50:   50 * time.Millisecond,
+		P90:   90 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+	}
+	s.StdDev, want.StdDev = s.StdDev.Round(time.Millisecond), 29*time.Millisecond
+	if s != want {
+		t.Errorf("期望 %+v\n实际 %+v", want, s)
+	}
+	if latencies[0] != 100*time.Millisecond {
+		t.Error("computeLatencyStats 不应该修改传入的切片")
+	}
+
+	if empty := computeLatencyStats(nil); empty != (LatencyStats{}) {
+		t.Errorf("空输入期望零值, 但得到了 %+v", empty)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var r LatencyRecorder
+	for _, d := range []time.Duration{
+		3 * time.Millisecond, 5 * time.Millisecond, // <= 5ms
+		40 * time.Millisecond, // <= 50ms
+		20 * time.Second,      // +Inf
+	} {
+		r.Add(d)
+	}
+	buckets := r.Histogram()
+	if len(buckets) != len(latencyBuckets)+1 {
+		t.Fatalf("期望 %d 个桶, 但得到了 %d 个", len(latencyBuckets)+1, len(buckets))
+	}
+	if buckets[0].Count != 2 || buckets[3].Count != 1 || buckets[len(buckets)-1].Count != 1 {
+		t.Errorf("分桶错误: %+v", buckets)
+	}
+
+	var buf bytes.Buffer
+	printHistogram(&buf, buckets)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(buckets) {
+		t.Errorf("期望从第一个到最后一个有数据的桶都画出来, 但得到了:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[0], strings.Repeat("#", 40)+" 2") {
+		t.Errorf("数量最多的桶应该画满, 但得到了 %q", lines[0])
+	}
+}
+
+func TestRollingWindow(t *testing.T) {
+	w := NewRollingWindow(3)
+	w.Add(1)
+	w.Add(2)
+	if got := w.Values(); len(got) != 2 {
+		t.Errorf("期望 2 个值, 但得到了 %v", got)
+	}
+	w.Add(3)
+	w.Add(4) // 覆盖掉最旧的 1
+	s := computeLatencyStats(w.Values())
+	if s.Count != 3 || s.Min != 2 || s.Max != 4 {
+		t.Errorf("期望窗口中是 2、3、4, 但得到了 %v", w.Values())
+	}
+}
+
+func TestLatencyRecorder(t *testing.T) {
+	// 和 TestComputeLatencyStats 一样的数据，精确值应该完全一致，分位数误差在 2% 以内
+	var latencies []time.Duration
+	var r LatencyRecorder
+	for i := 100; i >= 1; i-- {
+		d := time.Duration(i) * time.Millisecond
+		latencies = append(latencies, d)
+		r.Add(d)
+	}
+	got, want := r.Stats(), computeLatencyStats(latencies)
+	if got.Count != want.Count || got.Min != want.Min || got.Max != want.Max || got.Mean != want.Mean {
+		t.Errorf("期望 %+v\n实际 %+v", want, got)
+	}
+	if got.StdDev.Round(time.Millisecond) != want.StdDev.Round(time.Millisecond) {
+		t.Errorf("期望标准差 %v, 但得到了 %v", want.StdDev, got.StdDev)
+	}
+	for _, p := range [][2]time.Duration{{got.P50, want.P50}, {got.P90, want.P90}, {got.P95, want.P95}, {got.P99, want.P99}} {
+		if diff := p[0] - p[1]; diff < -p[1]/50 || diff > p[1]/50 {
+			t.Errorf("分位数误差太大: 期望 %v, 但得到了 %v", p[1], p[0])
+		}
+	}
+	total := 0
+	for _, b := range r.Histogram() {
+		total += b.Count
+	}
+	if total != 100 {
+		t.Errorf("期望直方图中一共 100 个延迟, 但得到了 %d 个", total)
+	}
+
+	var empty LatencyRecorder
+	if empty.Stats() != (LatencyStats{}) || empty.Histogram() != nil {
+		t.Error("没有数据时期望零值")
+	}
+}
+
+func TestSketchIndex(t *testing.T) {
+	// 每个值都落在估算值附近，并且桶的编号随着值单调递增
+	prev := -1
+	for _, d := range []time.Duration{0, 1, 63, 64, 127, 128, 1000, time.Millisecond, time.Second, time.Hour} {
+		i := sketchIndex(d)
+		if i < prev {
+			t.Errorf("%v 的桶编号 %d 比前一个值的 %d 小", d, i, prev)
+		}
+		prev = i
+		if v := sketchValue(i); v < d-d/sketchSub || v > d+d/sketchSub {
+			t.Errorf("%v 所在桶的估算值 %v 误差太大", d, v)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// 知识点：终端的设置（是否回显、是否按行缓冲）和窗口大小都通过 ioctl 读写，
+// 标准库没有封装，这里直接用 syscall 调用，所以这个文件只在 Linux 上编译。
+
+func ioctl(fd int, req uint, arg unsafe.Pointer) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg)); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// isTerminal 判断 fd 是不是一个终端
+func isTerminal(fd int) bool {
+	var t syscall.Termios
+	return ioctl(fd, syscall.TCGETS, unsafe.Pointer(&t)) == nil
+}
+
+// terminalSize 返回终端的列数和行数
+func terminalSize(fd int) (width, height int, ok bool) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	if ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)) != nil || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Col), int(ws.Row), true
+}
+
+// makeCbreak 让终端不回显、不按行缓冲，按键立即就能读到，返回恢复原来设置的函数。
+// 和 raw 模式不同，ISIG 保持打开，Ctrl-C 仍然会发送 SIGINT
+func makeCbreak(fd int) (restore func(), err error) {
+	var old syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	t := old
+	t.Lflag &^= syscall.ICANON | syscall.ECHO
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&t)); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, syscall.TCSETS, unsafe.Pointer(&old)) }, nil
+}
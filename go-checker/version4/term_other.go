@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// 其他系统上不支持仪表盘，-tui 退回普通输出
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func terminalSize(fd int) (width, height int, ok bool) {
+	return 0, 0, false
+}
+
+func makeCbreak(fd int) (restore func(), err error) {
+	return nil, errors.New("不支持的系统")
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+// State 是一个目标在持续监控中的状态
+type State string
+
+const (
+	StateUnknown State = "UNKNOWN" // 还没有检查过
+	StateUp      State = "UP"
+	StateWarn    State = "WARN" // 检查成功，但有警告（如证书即将过期）
+	StateDown    State = "DOWN"
+)
+
+// stateOf 根据一次检查结果得出目标的状态
+func stateOf(res checker.Result) State {
+	switch {
+	case res.Warn():
+		return StateWarn
+	case res.OK():
+		return StateUp
+	}
+	return StateDown
+}
+
+// Transition 记录一次状态变化，如 UP→DOWN
+type Transition struct {
+	Key      string
+	From, To State
+	At       time.Time
+	Duration time.Duration  // 在上一个状态中停留的时间
+	Result   checker.Result // 触发这次变化的检查结果
+}
+
+// targetState 是一个目标当前的状态
+type targetState struct {
+	State     State
+	Since     time.Time // 进入当前状态的时间
+	LastCheck time.Time
+	Latencies *RollingWindow // 最近若干次成功检查的延迟
+}
+
+// StateTracker 记录每个目标的状态，并在状态变化时给出 Transition。
+// 结果可能来自多个 goroutine，所以用互斥锁保护 map。
+type StateTracker struct {
+	mu     sync.Mutex
+	states map[string]*targetState
+	window int // 每个目标保留多少个最近的延迟
+}
+
+// NewStateTracker 创建 StateTracker，window 是每个目标用于计算分位数的延迟个数
+func NewStateTracker(window int) *StateTracker {
+	return &StateTracker{states: make(map[string]*targetState), window: window}
+}
+
+// Observe 记录一次检查结果，如果目标状态发生了变化则返回 Transition 和 true。
+// 目标第一次被检查时也算一次变化（UNKNOWN→UP 或 UNKNOWN→DOWN）。
+func (s *StateTracker) Observe(res checker.Result, at time.Time) (Transition, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := resultKey(res)
+	st, ok := s.states[key]
+	if !ok {
+		st = &targetState{State: StateUnknown, Since: at, Latencies: NewRollingWindow(s.window)}
+		s.states[key] = st
+	}
+	st.LastCheck = at
+	if res.OK() {
+		st.Latencies.Add(res.Latency)
+	}
+
+	to := stateOf(res)
+	if to == st.State {
+		return Transition{}, false
+	}
+	tr := Transition{Key: key, From: st.State, To: to, At: at, Duration: at.Sub(st.Since), Result: res}
+	st.State, st.Since = to, at
+	return tr, true
+}
+
+// TargetStatus 是某个时刻一个目标的状态快照
+type TargetStatus struct {
+	Key       string
+	State     State
+	Since     time.Time
+	LastCheck time.Time
+	Latency   LatencyStats // 滚动窗口内的延迟统计
+}
+
+// Snapshot 返回所有目标当前的状态，按名称排序
+func (s *StateTracker) Snapshot() []TargetStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]TargetStatus, 0, len(s.states))
+	for key, st := range s.states {
+		statuses = append(statuses, TargetStatus{
+			Key:       key,
+			State:     st.State,
+			Since:     st.Since,
+			LastCheck: st.LastCheck,
+			Latency:   computeLatencyStats(st.Latencies.Values()),
+		})
+	}
+	slices.SortFunc(statuses, func(a, b TargetStatus) int { return strings.Compare(a.Key, b.Key) })
+	return statuses
+}
+
+// resultKey 是一个目标在 StateTracker 中的标识，有名称时用名称，否则用 URL
+func resultKey(res checker.Result) string {
+	if res.Name != "" {
+		return res.Name
+	}
+	return res.URL
+}
+
+// watchInterval 返回一个目标在监控模式下的检查间隔
+func watchInterval(t checker.Target, fallback time.Duration) time.Duration {
+	if t.Interval > 0 {
+		return t.Interval
+	}
+	return fallback
+}
+
+// runWatch 持续监控所有目标：worker 池一直保持运行，每个目标按照自己的间隔
+// 被重新放进 jobs channel，结果交给 StateTracker 判断状态是否变化。
+// 每个结果还会交给 onResult，用来更新指标等。
+// summaryEvery 大于 0 时，每隔这么久打印一次所有目标的状态和滚动窗口内的延迟分位数。
+// ctx 被取消时停止调度，打印最后一次状态汇总后返回。
+func runWatch(ctx context.Context, targets []checker.Target, opts checker.Options, defaultInterval time.Duration, window int, summaryEvery time.Duration, onResult func(checker.Result)) {
+	jobs := make(chan checker.Target, len(targets))
+	results := checker.RunStream(ctx, jobs, opts)
+
+	// 知识点：每个目标一个调度 goroutine，用 time.Ticker 按固定间隔投递任务。
+	// jobs channel 永远不关闭，所以 worker 会一直存活。
+	for _, t := range targets {
+		go func(t checker.Target) {
+			ticker := time.NewTicker(watchInterval(t, defaultInterval))
+			defer ticker.Stop()
+			for {
+				select {
+				case jobs <- t:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(t)
+	}
+
+	// summaryTick 为 nil 时，select 中对应的分支永远不会被选中
+	var summaryTick <-chan time.Time
+	if summaryEvery > 0 {
+		ticker := time.NewTicker(summaryEvery)
+		defer ticker.Stop()
+		summaryTick = ticker.C
+	}
+
+	tracker := NewStateTracker(window)
+	for {
+		select {
+		case res := <-results:
+			if res.Category() == checker.CategoryCanceled {
+				continue // 正在退出，被取消的检查不代表目标的状态
+			}
+			onResult(res)
+			if tr, changed := tracker.Observe(res, time.Now()); changed {
+				printTransition(tr)
+			}
+		case <-summaryTick:
+			printWatchSummary(os.Stdout, tracker.Snapshot(), window)
+		case <-ctx.Done():
+			printWatchSummary(os.Stdout, tracker.Snapshot(), window)
+			return
+		}
+	}
+}
+
+// printWatchSummary 打印监控模式下的状态汇总
+func printWatchSummary(out io.Writer, statuses []TargetStatus, window int) {
+	fmt.Fprintf(out, "\n--- 状态汇总 %s（延迟为最近 %d 次成功检查）---\n", time.Now().Format("2006-01-02 15:04:05"), window)
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	fmt.Fprintln(w, "Target\tState\tSince\tP50\tP95\tP99\tMax\t")
+	for _, st := range statuses {
+		l := st.Latency
+		if l.Count == 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\tN/A\tN/A\tN/A\tN/A\t\n", st.Key, st.State, st.Since.Format("15:04:05"))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%v\t%v\t%v\t\n", st.Key, st.State, st.Since.Format("15:04:05"), l.P50, l.P95, l.P99, l.Max)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+}
+
+// printTransition 打印一次状态变化
+func printTransition(tr Transition) {
+	at := tr.At.Format("2006-01-02 15:04:05")
+	if tr.From == StateUnknown {
+		fmt.Printf("[%s] %s 初始状态 %s", at, tr.Key, tr.To)
+	} else {
+		fmt.Printf("[%s] %s %s→%s（%s 状态持续了 %v）", at, tr.Key, tr.From, tr.To, tr.From, tr.Duration.Round(time.Second))
+	}
+	if tr.To == StateDown || tr.To == StateWarn {
+		fmt.Printf(" 原因: %s", errorText(tr.Result))
+	}
+	fmt.Println()
+}
+
+// printBreaker 打印一个主机的熔断器的状态变化，在 worker 的 goroutine 中调用
+func printBreaker(e checker.BreakerEvent) {
+	at := e.At.Format("2006-01-02 15:04:05")
+	switch e.To {
+	case checker.BreakerOpen:
+		fmt.Printf("[%s] 主机 %s 熔断（连续 %d 次连接失败: %v），暂停检查它的目标\n", at, e.Host, e.Failures, e.Error)
+	case checker.BreakerHalfOpen:
+		fmt.Printf("[%s] 主机 %s 熔断已到期，试探一次\n", at, e.Host)
+	case checker.BreakerClosed:
+		fmt.Printf("[%s] 主机 %s 已恢复，继续检查\n", at, e.Host)
+	}
+}
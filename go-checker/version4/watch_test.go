@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-learning/go-checker/version4/checker"
+)
+
+func TestStateTrackerTransitions(t *testing.T) {
+	tracker := NewStateTracker(10)
+	start := time.Now()
+	up := checker.Result{Name: "api", StatusCode: 200}
+	down := checker.Result{Name: "api", Error: errors.New("connection refused")}
+
+	steps := []struct {
+		res     checker.Result
+		changed bool
+		from    State
+		to      State
+	}{
+		{up, true, StateUnknown, StateUp},
+		{up, false, "", ""},
+		{down, true, StateUp, StateDown},
+		{down, false, "", ""},
+		{up, true, StateDown, StateUp},
+	}
+	for i, step := range steps {
+		at := start.Add(time.Duration(i) * time.Minute)
+		tr, changed := tracker.Observe(step.res, at)
+		if changed != step.changed {
+			t.Fatalf("第 %d 次检查: 期望 changed=%v, 但得到了 %v", i+1, step.changed, changed)
+		}
+		if !changed {
+			continue
+		}
+		if tr.From != step.from || tr.To != step.to {
+			t.Errorf("第 %d 次检查: 期望 %s→%s, 但得到了 %s→%s", i+1, step.from, step.to, tr.From, tr.To)
+		}
+		if !tr.At.Equal(at) {
+			t.Errorf("第 %d 次检查: 期望变化时间 %v, 但得到了 %v", i+1, at, tr.At)
+		}
+	}
+
+	// 最后一次 DOWN→UP 发生在第 4 分钟，UP 状态一直持续到第 10 分钟
+	tr, _ := tracker.Observe(down, start.Add(10*time.Minute))
+	if tr.Duration != 6*time.Minute {
+		t.Errorf("期望 UP 状态持续 6m0s, 但得到了 %v", tr.Duration)
+	}
+}
+
+func TestStateTrackerSeparatesTargets(t *testing.T) {
+	tracker := NewStateTracker(10)
+	now := time.Now()
+	tracker.Observe(checker.Result{URL: "https://a.com"}, now)
+	if _, changed := tracker.Observe(checker.Result{URL: "https://b.com", Error: errors.New("timeout")}, now); !changed {
+		t.Error("期望不同目标的状态互不影响")
+	}
+}
+
+func TestStateTrackerSnapshot(t *testing.T) {
+	tracker := NewStateTracker(2)
+	now := time.Now()
+	for _, ms := range []int{10, 20, 30} {
+		tracker.Observe(checker.Result{Name: "b", Latency: time.Duration(ms) * time.Millisecond}, now)
+	}
+	tracker.Observe(checker.Result{Name: "a", Error: errors.New("timeout")}, now)
+
+	snap := tracker.Snapshot()
+	if len(snap) != 2 || snap[0].Key != "a" || snap[1].Key != "b" {
+		t.Fatalf("期望按名称排序的两个目标, 但得到了 %+v", snap)
+	}
+	if snap[0].State != StateDown || snap[0].Latency.Count != 0 {
+		t.Errorf("失败的检查不应该计入延迟: %+v", snap[0])
+	}
+	// 窗口大小为 2，只保留最近的 20ms 和 30ms
+	if l := snap[1].Latency; l.Count != 2 || l.Min != 20*time.Millisecond {
+		t.Errorf("期望滚动窗口中只有最近 2 次延迟, 但得到了 %+v", l)
+	}
+}